@@ -3,16 +3,31 @@ package zfs
 // #include <stdlib.h>
 // #include <string.h>
 // #include <libzfs.h>
+// #include <libzfs_core.h>
 // #include "common.h"
 // #include "zpool.h"
 // #include "zfs.h"
 import "C"
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 	"syscall"
+	"time"
+	"unsafe"
 )
 
+// Bookmark - bookmark of filesystem or volume and its properties
+type Bookmark struct {
+	Name      string    `json:"name"` // full name pool/fs#bookmark
+	GUID      uint64    `json:"guid"`
+	CreateTXG uint64    `json:"createtxg"`
+	Creation  time.Time `json:"creation"`
+}
+
+var bookmarkProps = []DatasetProp{DatasetPropGUID, DatasetPropCreateTXG, DatasetPropCreation}
+
 func (self *Dataset) CreateBookmark(name string) (*Dataset, error) {
 	sourcePath, _ := self.Path()
 	var bookmarkPath string
@@ -28,24 +43,157 @@ func (self *Dataset) CreateBookmark(name string) (*Dataset, error) {
 		tmp := strings.Split(sourcePath, "#")
 		bookmarkPath = tmp[0] + "#" + name
 	}
-	nvl := C.fnvlist_alloc();
-	C.fnvlist_add_string(nvl, C.CString(bookmarkPath), C.CString(sourcePath))
-	var errlist **C.nvlist_t
-	_, err := C.lzc_bookmark(nvl, errlist);
-	C.fnvlist_free(nvl);
-	if err != nil {
-		if errno, ok := err.(syscall.Errno); ok {
-			return nil, NewError(
-				ErrorCode(errno),
-				err.Error(),
-			)
-		} else {
-			return nil, NewError(
-				EUndefined,
-				err.Error(),
-			)
+	if err := CreateBookmarks(map[string]string{bookmarkPath: sourcePath}); err != nil {
+		if berr, ok := err.(*BatchError); ok && len(berr.Errors) == 1 {
+			err = berr.Errors[bookmarkPath]
 		}
+		return nil, err
 	}
 	dm, err := DatasetOpen(bookmarkPath)
 	return &dm, err
 }
+
+// CreateBookmarks atomically create bookmarks in single transaction.
+// Bookmarks maps full bookmark name (pool/fs#bookmark) to its source snapshot
+// (or bookmark on newer versions) of the same filesystem. All bookmarks have
+// to be in the same pool. On failure *BatchError is returned.
+func CreateBookmarks(bookmarks map[string]string) (err error) {
+	names := make([]string, 0, len(bookmarks))
+	for name := range bookmarks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err = checkSamePool(names, "#", "bookmark"); err != nil {
+		return
+	}
+	cbmarks := C.fnvlist_alloc()
+	defer C.nvlist_free(cbmarks)
+	for _, name := range names {
+		csName := C.CString(name)
+		csSource := C.CString(bookmarks[name])
+		C.fnvlist_add_string(cbmarks, csName, csSource)
+		C.free(unsafe.Pointer(csName))
+		C.free(unsafe.Pointer(csSource))
+	}
+	var errlist *C.nvlist_t
+	if rc := C.lzc_bookmark(cbmarks, &errlist); rc != 0 {
+		err = lzcBatchError(errlist, syscall.Errno(rc), "cannot create bookmark")
+	}
+	return
+}
+
+// DestroyBookmarks atomically destroy bookmarks given by full names
+// (pool/fs#bookmark). All bookmarks have to be in the same pool. Bookmarks
+// that don't exist are ignored. On failure *BatchError is returned.
+func DestroyBookmarks(names []string) (err error) {
+	if err = checkSamePool(names, "#", "bookmark"); err != nil {
+		return
+	}
+	cbmarks := C.fnvlist_alloc()
+	defer C.nvlist_free(cbmarks)
+	for _, name := range names {
+		csName := C.CString(name)
+		C.fnvlist_add_boolean(cbmarks, csName)
+		C.free(unsafe.Pointer(csName))
+	}
+	var errlist *C.nvlist_t
+	if rc := C.lzc_destroy_bookmarks(cbmarks, &errlist); rc != 0 {
+		err = lzcBatchError(errlist, syscall.Errno(rc), "cannot destroy bookmark")
+	}
+	return
+}
+
+// Bookmarks returns bookmarks of filesystem or volume sorted by createtxg
+func (d *Dataset) Bookmarks() (bookmarks []Bookmark, err error) {
+	var path string
+	if path, err = d.Path(); err != nil {
+		return
+	}
+	if d.Type != DatasetTypeFilesystem && d.Type != DatasetTypeVolume {
+		err = NewError(EBadtype, fmt.Sprintf("'%s' is not a filesystem or volume", path))
+		return
+	}
+	cprops := C.fnvlist_alloc()
+	defer C.nvlist_free(cprops)
+	for _, p := range bookmarkProps {
+		C.fnvlist_add_boolean(cprops, C.zfs_prop_to_name(C.zfs_prop_t(p)))
+	}
+	csPath := C.CString(path)
+	defer C.free(unsafe.Pointer(csPath))
+	var cbmarks *C.nvlist_t
+	if rc := C.lzc_get_bookmarks(csPath, cprops, &cbmarks); rc != 0 {
+		err = errnoError(syscall.Errno(rc), fmt.Sprintf("cannot get bookmarks of '%s'", path))
+		return
+	}
+	defer C.nvlist_free(cbmarks)
+	for nvp := C.nvlist_next_nvpair(cbmarks, nil); nvp != nil; nvp = C.nvlist_next_nvpair(cbmarks, nvp) {
+		var bprops *C.nvlist_t
+		if C.nvpair_value_nvlist(nvp, &bprops) != 0 {
+			continue
+		}
+		bm := Bookmark{Name: path + "#" + C.GoString(C.nvpair_name(nvp))}
+		bm.GUID = bookmarkPropValue(bprops, DatasetPropGUID)
+		bm.CreateTXG = bookmarkPropValue(bprops, DatasetPropCreateTXG)
+		bm.Creation = time.Unix(int64(bookmarkPropValue(bprops, DatasetPropCreation)), 0)
+		bookmarks = append(bookmarks, bm)
+	}
+	sort.Slice(bookmarks, func(i, j int) bool {
+		return bookmarks[i].CreateTXG < bookmarks[j].CreateTXG
+	})
+	return
+}
+
+// bookmarkPropValue - lzc_get_bookmarks returns properties as
+// name -> { "value" -> uint64 }
+func bookmarkPropValue(bprops *C.nvlist_t, p DatasetProp) (value uint64) {
+	var prop *C.nvlist_t
+	if C.nvlist_lookup_nvlist(bprops, C.zfs_prop_to_name(C.zfs_prop_t(p)), &prop) != 0 {
+		return
+	}
+	csValue := C.CString("value")
+	defer C.free(unsafe.Pointer(csValue))
+	var v C.uint64_t
+	if C.nvlist_lookup_uint64(prop, csValue, &v) == 0 {
+		value = uint64(v)
+	}
+	return
+}
+
+// bookmarkShortName - name of bookmark given as full name, #name or name
+func bookmarkShortName(name string) string {
+	if i := strings.LastIndex(name, "#"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// Redact creates redaction bookmark of snapshot d (zfs redact). Streams sent
+// with SendOptions.RedactBookmark set to it leave out blocks modified in
+// redactSnaps, which are full names of snapshots of clones of d. Bookmark
+// can be given as full name, #bookmark or short name. Redaction requires
+// OpenZFS 2.0 or newer, ENotsup is returned otherwise.
+func (d *Dataset) Redact(bookmark string, redactSnaps []string) (err error) {
+	var path string
+	if path, err = d.Path(); err != nil {
+		return
+	}
+	if d.Type != DatasetTypeSnapshot {
+		err = NewError(EBadtype, fmt.Sprintf("'%s' is not a snapshot", path))
+		return
+	}
+	csnaps := C.fnvlist_alloc()
+	defer C.nvlist_free(csnaps)
+	for _, name := range redactSnaps {
+		csName := C.CString(name)
+		C.fnvlist_add_boolean(csnaps, csName)
+		C.free(unsafe.Pointer(csName))
+	}
+	csPath := C.CString(path)
+	defer C.free(unsafe.Pointer(csPath))
+	csBook := C.CString(bookmarkShortName(bookmark))
+	defer C.free(unsafe.Pointer(csBook))
+	if rc := C.dataset_redact(csPath, csBook, csnaps); rc != 0 {
+		err = errnoError(syscall.Errno(rc), fmt.Sprintf("cannot redact '%s'", path))
+	}
+	return
+}
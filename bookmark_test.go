@@ -1,7 +1,11 @@
 package zfs
 
 import (
+	"bytes"
+	"fmt"
 	"testing"
+
+	"github.com/hainguyen8y/go-libzfs/sendstream"
 )
 
 func TestBookmark(t *testing.T) {
@@ -56,3 +60,144 @@ func TestBookmark(t *testing.T) {
 
 	snap.Destroy(false)
 }
+
+func TestBookmarks(t *testing.T) {
+	testDatasetName := *testPool + "/tank1"
+	snap, err := DatasetSnapshot(testDatasetName+"@bmsrc", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	defer snap.Destroy(false)
+
+	names := []string{testDatasetName + "#bm1", testDatasetName + "#bm2"}
+	t.Log("TEST CreateBookmarks(", names, ") ... ")
+	if err = CreateBookmarks(map[string]string{
+		names[0]: testDatasetName + "@bmsrc",
+		names[1]: testDatasetName + "@bmsrc",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := DatasetOpen(testDatasetName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	bookmarks, err := ds.Bookmarks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, bm := range bookmarks {
+		if bm.Name == names[0] || bm.Name == names[1] {
+			if bm.GUID == 0 || bm.CreateTXG == 0 || bm.Creation.Unix() == 0 {
+				t.Errorf("bookmark %s with missing properties %+v", bm.Name, bm)
+			}
+			found++
+		}
+	}
+	if found != len(names) {
+		t.Fatalf("created bookmarks not listed %v", bookmarks)
+	}
+
+	t.Log("TEST DestroyBookmarks(", names, ") ... ")
+	if err = DestroyBookmarks(names); err != nil {
+		t.Fatal(err)
+	}
+	if bookmarks, err = ds.Bookmarks(); err != nil {
+		t.Fatal(err)
+	}
+	for _, bm := range bookmarks {
+		if bm.Name == names[0] || bm.Name == names[1] {
+			t.Errorf("bookmark %s not destroyed", bm.Name)
+		}
+	}
+}
+
+func TestSendFromBookmark(t *testing.T) {
+	testDatasetName := *testPool + "/tank1"
+	from, err := DatasetSnapshot(testDatasetName+"@bmfrom", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+	defer from.Destroy(false)
+	bm, err := from.CreateBookmark("bmfrom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bm.Close()
+	defer bm.Destroy(false)
+	snap, err := DatasetSnapshot(testDatasetName+"@bmto", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	defer snap.Destroy(false)
+
+	t.Log("TEST SendFrom(", testDatasetName+"#bmfrom", ") ... ")
+	var stream bytes.Buffer
+	if err = snap.SendFrom("#bmfrom", &stream, SendFlags{}); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := sendstream.Inspect(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guid := from.Properties[DatasetPropGUID].Value
+	if len(sum.Streams) != 1 || sum.Streams[0].ToName != testDatasetName+"@bmto" ||
+		fmt.Sprint(sum.Streams[0].FromGUID) != guid {
+		t.Errorf("unexpected stream from bookmark %+v", sum.Streams)
+	}
+	if err = snap.SendFrom("#bmfrom", &stream, SendFlags{DoAll: true}); err == nil {
+		t.Error("intermediary send from bookmark have to be rejected")
+	}
+	for _, flags := range []SendFlags{{DryRun: true}, {Props: true}, {Dedup: true}, {Backup: true}} {
+		stream.Reset()
+		if err = snap.SendFrom("#bmfrom", &stream, flags); err == nil || stream.Len() > 0 {
+			t.Errorf("send from bookmark with %+v have to be rejected", flags)
+		}
+	}
+}
+
+func TestRedactedSend(t *testing.T) {
+	testDatasetName := *testPool + "/tank1"
+	snap, err := DatasetSnapshot(testDatasetName+"@redsrc", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	defer snap.Destroy(false)
+	clone, err := snap.Clone(*testPool+"/redclone", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clone.Close()
+	defer clone.DestroyRecursive()
+	csnap, err := DatasetSnapshot(*testPool+"/redclone@red", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csnap.Close()
+
+	t.Log("TEST Redact(", testDatasetName+"#red", ") ... ")
+	if err = snap.Redact("red", []string{*testPool + "/redclone@red"}); err != nil {
+		if e, ok := err.(*Error); ok && e.ErrorCode() == ENotsup {
+			t.Skip("redaction is not supported:", err)
+		}
+		t.Fatal(err)
+	}
+	defer DestroyBookmarks([]string{testDatasetName + "#red"})
+	var stream bytes.Buffer
+	if err = snap.SendWithOptions(&stream, "", SendOptions{RedactBookmark: "#red"}); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := sendstream.Inspect(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sum.Streams) != 1 || sum.Streams[0].Features&sendstream.FeatureRedacted == 0 {
+		t.Errorf("stream is not redacted %+v", sum.Streams)
+	}
+}
@@ -23,7 +23,10 @@ package zfs
 import "C"
 
 import (
+	"fmt"
+	"strings"
 	"sync"
+	"syscall"
 )
 
 // VDevType type of device in the pool
@@ -68,6 +71,11 @@ type VDevAux uint64
 type PropertyValue struct {
 	Value  string	`json:"value"`
 	Source string	`json:"source"`
+	// Numeric raw value of numeric and index dataset properties, valid
+	// only if IsNumeric is true
+	Numeric    uint64         `json:"-"`
+	IsNumeric  bool           `json:"-"`
+	SourceType PropertySource `json:"-"`
 }
 
 var Global struct {
@@ -304,6 +312,63 @@ func LastErrorCode() int {
 	return int(C.libzfs_last_error())
 }
 
+// lzcErrors - convert errlist nvlist (name -> errno) returned by libzfs_core
+// batch operations to map of errors
+func lzcErrors(errlist *C.nvlist_t, msg string) (errs map[string]error) {
+	errs = make(map[string]error)
+	if errlist == nil {
+		return
+	}
+	var errno C.int32_t
+	for nvp := C.nvlist_next_nvpair(errlist, nil); nvp != nil; nvp = C.nvlist_next_nvpair(errlist, nvp) {
+		name := C.GoString(C.nvpair_name(nvp))
+		// libzfs_core reports count of errors not listed as N_MORE_ERRORS
+		if name == "N_MORE_ERRORS" || C.nvpair_value_int32(nvp, &errno) != 0 {
+			continue
+		}
+		errs[name] = errnoError(syscall.Errno(errno), msg+" '"+name+"'")
+	}
+	return
+}
+
+// lzcBatchError - build *BatchError of failed libzfs_core batch operation,
+// errlist is freed
+func lzcBatchError(errlist *C.nvlist_t, errno syscall.Errno, msg string) error {
+	berr := &BatchError{Errors: lzcErrors(errlist, msg)}
+	if len(berr.Errors) == 0 {
+		berr.Err = errnoError(errno, msg+"s")
+	}
+	if errlist != nil {
+		C.nvlist_free(errlist)
+	}
+	return berr
+}
+
+// checkSamePool - libzfs_core batch operations require all names (snapshots
+// or bookmarks split by sep) of single call to be in the same pool
+func checkSamePool(names []string, sep string, kind string) error {
+	if len(names) == 0 {
+		return NewError(EInvalidname, fmt.Sprintf("no %ss specified", kind))
+	}
+	var pool string
+	for _, name := range names {
+		i := strings.Index(name, sep)
+		if i <= 0 {
+			return NewError(EInvalidname, fmt.Sprintf("'%s' is not a %s name", name, kind))
+		}
+		pname := name[:i]
+		if i := strings.Index(pname, "/"); i >= 0 {
+			pname = pname[:i]
+		}
+		if len(pool) == 0 {
+			pool = pname
+		} else if pool != pname {
+			return NewError(ECrosstarget, fmt.Sprintf("'%s' is not in pool '%s', %ss have to be in the same pool", name, pool, kind))
+		}
+	}
+	return nil
+}
+
 func booleanT(b bool) (r C.boolean_t) {
 	if b {
 		return 1
@@ -30,6 +30,9 @@ typedef struct property_list {
 	char value[INT_MAX_VALUE];
 	char source[ZFS_MAX_DATASET_NAME_LEN];
 	int property;
+	int source_type;
+	int numeric_valid;
+	uint64_t numeric;
 	void *pnext;
 } property_list_t;
 
@@ -2,6 +2,7 @@ package zfs
 
 // #include <stdlib.h>
 // #include <libzfs.h>
+// #include <libzfs_core.h>
 // #include "common.h"
 // #include "zpool.h"
 // #include "zfs.h"
@@ -13,6 +14,7 @@ import (
 	"sort"
 	"strings"
 	"encoding/json"
+	"syscall"
 	"time"
 	"unsafe"
 )
@@ -234,6 +236,33 @@ func DatasetCreate(path string, dtype DatasetType,
 	return DatasetOpen(path)
 }
 
+// DatasetCreateWithFlags create a new filesystem or volume like DatasetCreate
+// honouring flags. With IsParentCreated missing parent filesystems are
+// created and existing dataset on path is not an error. Non sparse volumes
+// get default refreservation (reservation on old pools) computed from
+// volsize the same way as zfs create -V does, unless set in props.
+func DatasetCreateWithFlags(path string, dtype DatasetType,
+	props map[DatasetProp]PropertyValue, flags *CreateFlags) (d Dataset, err error) {
+	var cprops C.nvlist_ptr
+	if flags == nil {
+		flags = &CreateFlags{}
+	}
+	if cprops, err = datasetPropertiesTonvlist(props); err != nil {
+		return
+	}
+	defer C.nvlist_free(cprops)
+
+	csPath := C.CString(path)
+	errcode := C.dataset_create_ex(csPath, C.zfs_type_t(dtype), cprops,
+		booleanT(flags.IsParentCreated), booleanT(flags.SparseVolume))
+	C.free(unsafe.Pointer(csPath))
+	if errcode != 0 {
+		err = LastError()
+		return
+	}
+	return DatasetOpen(path)
+}
+
 // Close close dataset and all its recursive children datasets (close handle
 // and cleanup dataset object/s from memory)
 func (d *Dataset) Close() {
@@ -379,8 +408,7 @@ func (d *Dataset) ReloadProperties() (err error) {
 		if plist == nil {
 			continue
 		}
-		d.Properties[prop] = PropertyValue{Value: C.GoString(&(*plist).value[0]),
-			Source: C.GoString(&(*plist).source[0])}
+		d.Properties[prop] = propertyValue(plist)
 		C.free_properties(plist)
 	}
 	return
@@ -401,8 +429,7 @@ func (d *Dataset) GetProperty(p DatasetProp) (prop PropertyValue, err error) {
 		return
 	}
 	defer C.free_properties(plist)
-	prop = PropertyValue{Value: C.GoString(&(*plist).value[0]),
-		Source: C.GoString(&(*plist).source[0])}
+	prop = propertyValue(plist)
 	d.Properties[p] = prop
 	return
 }
@@ -421,8 +448,7 @@ func (d *Dataset) GetUserProperty(p string) (prop PropertyValue, err error) {
 		return
 	}
 	defer C.free_properties(plist)
-	prop = PropertyValue{Value: C.GoString(&(*plist).value[0]),
-		Source: C.GoString(&(*plist).source[0])}
+	prop = propertyValue(plist)
 	return
 }
 
@@ -464,6 +490,176 @@ func (d *Dataset) SetUserProperty(prop, value string) (err error) {
 	return
 }
 
+// SetProperties set several dataset and user properties at once with single
+// libzfs call. Every value is validated first and nothing is set if any of
+// them is rejected. Returned error is *PropertiesError holding error per
+// rejected property name, including values kernel refused to set (e.g. quota
+// below used space). When properties which make libzfs remount, reshare or
+// resize the dataset fail together, the error is not split per property.
+func (d *Dataset) SetProperties(props map[DatasetProp]string, userProps map[string]string) (err error) {
+	if d.list == nil {
+		err = NewError(EUndefined, msgDatasetIsNil)
+		return
+	}
+	values := make(map[string]string, len(props)+len(userProps))
+	for p, value := range props {
+		values[DatasetPropertyToName(p)] = value
+	}
+	for prop, value := range userProps {
+		values[prop] = value
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	perr := &PropertiesError{Errors: make(map[string]error)}
+	cprops := C.new_property_nvlist()
+	if cprops == nil {
+		err = NewError(ENomem, "Failed to allocate properties")
+		return
+	}
+	defer C.nvlist_free(cprops)
+	for name, value := range values {
+		if verr := d.validateProperty(name, value); verr != nil {
+			perr.Errors[name] = verr
+			continue
+		}
+		csName := C.CString(name)
+		csValue := C.CString(value)
+		r := C.property_nvlist_add(cprops, csName, csValue)
+		C.free(unsafe.Pointer(csName))
+		C.free(unsafe.Pointer(csValue))
+		if r != 0 {
+			err = NewError(ENomem, "Failed to allocate properties")
+			return
+		}
+	}
+	if len(perr.Errors) > 0 {
+		err = perr
+		return
+	}
+
+	var errlist *C.nvlist_t
+	if errcode := C.dataset_prop_set_list(d.list, cprops, &errlist); errcode != 0 {
+		var serr error
+		if errcode < 0 {
+			serr = LastError()
+		} else {
+			serr = errnoError(syscall.Errno(errcode), "cannot set properties")
+		}
+		// kernel reports errno per property it failed to set
+		perr.Errors = lzcErrors(errlist, "cannot set property")
+		if errlist != nil {
+			C.nvlist_free(errlist)
+		}
+		if len(perr.Errors) == 0 {
+			if len(values) == 1 {
+				for name := range values {
+					perr.Errors[name] = serr
+				}
+			} else {
+				perr.Err = serr
+			}
+		}
+		err = perr
+	}
+	// Update Properties member with changes made
+	if rerr := d.ReloadProperties(); err == nil {
+		err = rerr
+	}
+	return
+}
+
+// validateProperty - check single property value the same way libzfs does
+// before setting it
+func (d *Dataset) validateProperty(name, value string) (err error) {
+	cprop := C.new_property_nvlist()
+	if cprop == nil {
+		return NewError(ENomem, "Failed to allocate properties")
+	}
+	defer C.nvlist_free(cprop)
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	csValue := C.CString(value)
+	defer C.free(unsafe.Pointer(csValue))
+	if C.property_nvlist_add(cprop, csName, csValue) != 0 {
+		return NewError(ENomem, "Failed to allocate properties")
+	}
+	if C.dataset_prop_valid(d.list, cprop) != 0 {
+		err = LastError()
+	}
+	return
+}
+
+// InheritProperty clear local value of property, so it is inherited from
+// parent (zfs inherit). Set recursive to inherit property on all descendent
+// datasets and received to revert to received value if any (-S).
+func (d *Dataset) InheritProperty(p DatasetProp, recursive, received bool) (err error) {
+	if d.list == nil {
+		err = NewError(EUndefined, msgDatasetIsNil)
+		return
+	}
+	name := DatasetPropertyToName(p)
+	if C.zfs_prop_readonly(C.zfs_prop_t(p)) != 0 {
+		err = NewError(EPropreadonly, fmt.Sprintf("'%s' property is read-only", name))
+		return
+	}
+	if !received && C.zfs_prop_inheritable(C.zfs_prop_t(p)) == 0 {
+		err = NewError(EPropnoninherit, fmt.Sprintf("'%s' property cannot be inherited", name))
+		return
+	}
+	if err = d.inheritProperty(name, recursive, received); err != nil {
+		return
+	}
+	err = d.reloadInherited(recursive)
+	return
+}
+
+// InheritUserProperty clear local value of user property, same as
+// InheritProperty.
+func (d *Dataset) InheritUserProperty(prop string, recursive, received bool) (err error) {
+	if d.list == nil {
+		err = NewError(EUndefined, msgDatasetIsNil)
+		return
+	}
+	csProp := C.CString(prop)
+	isUser := C.zfs_prop_user(csProp)
+	C.free(unsafe.Pointer(csProp))
+	if isUser == 0 {
+		err = NewError(EBadprop, fmt.Sprintf("'%s' is not a user property", prop))
+		return
+	}
+	if err = d.inheritProperty(prop, recursive, received); err != nil {
+		return
+	}
+	err = d.reloadInherited(recursive)
+	return
+}
+
+func (d *Dataset) inheritProperty(name string, recursive, received bool) (err error) {
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	if errcode := C.dataset_prop_inherit(d.list, csName,
+		booleanT(recursive), booleanT(received)); errcode != 0 {
+		err = LastError()
+	}
+	return
+}
+
+// reloadInherited re-read properties of dataset and if recursive
+// of its opened children, since they could change with inherit
+func (d *Dataset) reloadInherited(recursive bool) (err error) {
+	if err = d.ReloadProperties(); err != nil || !recursive {
+		return
+	}
+	for ci := range d.Children {
+		if err = d.Children[ci].reloadInherited(recursive); err != nil {
+			return
+		}
+	}
+	return
+}
+
 // Clone - clones the dataset.  The target must be of the same type as
 // the source.
 func (d *Dataset) Clone(target string, props map[DatasetProp]PropertyValue) (rd Dataset, err error) {
@@ -486,6 +682,34 @@ func (d *Dataset) Clone(target string, props map[DatasetProp]PropertyValue) (rd
 	return
 }
 
+// CloneWithFlags - clones the dataset like Clone honouring flags. With
+// IsParentCreated missing parent filesystems of target are created and
+// existing target is not an error.
+func (d *Dataset) CloneWithFlags(target string, props map[DatasetProp]PropertyValue,
+	flags *CloneFlags) (rd Dataset, err error) {
+	var cprops C.nvlist_ptr
+	if d.list == nil {
+		err = NewError(EUndefined, msgDatasetIsNil)
+		return
+	}
+	if flags == nil {
+		flags = &CloneFlags{}
+	}
+	if cprops, err = datasetPropertiesTonvlist(props); err != nil {
+		return
+	}
+	defer C.nvlist_free(cprops)
+	csTarget := C.CString(target)
+	defer C.free(unsafe.Pointer(csTarget))
+	if errc := C.dataset_clone_ex(d.list, csTarget, cprops,
+		booleanT(flags.IsParentCreated)); errc != 0 {
+		err = LastError()
+		return
+	}
+	rd, err = DatasetOpen(target)
+	return
+}
+
 // DatasetSnapshot create dataset snapshot. Set recur to true to snapshot child datasets.
 func DatasetSnapshot(path string, recur bool, props map[DatasetProp]PropertyValue) (rd Dataset, err error) {
 	var cprops C.nvlist_ptr
@@ -503,6 +727,49 @@ func DatasetSnapshot(path string, recur bool, props map[DatasetProp]PropertyValu
 	return
 }
 
+// SnapshotMany atomically create snapshots of several datasets of the same
+// pool in one transaction. Names are full snapshot paths (pool/fs@snap),
+// props are user properties set on all created snapshots. On failure
+// nothing is created and returned error is *BatchError with error per
+// rejected snapshot name. Created snapshots have to be closed.
+func SnapshotMany(names []string, props map[string]string) (snaps []Dataset, err error) {
+	if err = checkSamePool(names, "@", "snapshot"); err != nil {
+		return
+	}
+	csnaps := C.fnvlist_alloc()
+	defer C.nvlist_free(csnaps)
+	for _, name := range names {
+		csName := C.CString(name)
+		C.fnvlist_add_boolean(csnaps, csName)
+		C.free(unsafe.Pointer(csName))
+	}
+	cprops := C.fnvlist_alloc()
+	defer C.nvlist_free(cprops)
+	for prop, value := range props {
+		csProp := C.CString(prop)
+		csValue := C.CString(value)
+		C.fnvlist_add_string(cprops, csProp, csValue)
+		C.free(unsafe.Pointer(csProp))
+		C.free(unsafe.Pointer(csValue))
+	}
+
+	var errlist *C.nvlist_t
+	if rc := C.lzc_snapshot(csnaps, cprops, &errlist); rc != 0 {
+		err = lzcBatchError(errlist, syscall.Errno(rc), "cannot create snapshot")
+		return
+	}
+	for _, name := range names {
+		var snap Dataset
+		if snap, err = DatasetOpen(name); err != nil {
+			DatasetCloseAll(snaps)
+			snaps = nil
+			return
+		}
+		snaps = append(snaps, snap)
+	}
+	return
+}
+
 // Path return zfs dataset path/name
 func (d *Dataset) Path() (path string, err error) {
 	if d.list == nil {
@@ -528,6 +795,73 @@ func (d *Dataset) Rollback(snap *Dataset, force bool) (err error) {
 	return
 }
 
+// RollbackWithFlags rollback dataset to snapshot which doesn't need to be the
+// most recent one, like zfs rollback does. IsRecursiveDestroy (-r) destroys
+// more recent snapshots and bookmarks, R (-R) also their clones and
+// IsForcedToUnmountClones (-f) forces unmount of destroyed clones and of
+// dataset. Returns names of destroyed datasets, with IsDryRun nothing is
+// destroyed nor rolled back.
+func (d *Dataset) RollbackWithFlags(snap *Dataset, flags *RollbackFlags) (destroyed []string, err error) {
+	var dpath, spath string
+	if d.list == nil || snap == nil || snap.list == nil {
+		err = NewError(EUndefined, msgDatasetIsNil)
+		return
+	}
+	if flags == nil {
+		flags = &RollbackFlags{}
+	}
+	if dpath, err = d.Path(); err != nil {
+		return
+	}
+	if spath, err = snap.Path(); err != nil {
+		return
+	}
+	if !strings.HasPrefix(spath, dpath+"@") {
+		err = NewError(EBadtype, fmt.Sprintf("'%s' is not a snapshot of '%s'", spath, dpath))
+		return
+	}
+
+	var errname [C.ZFS_MAX_DATASET_NAME_LEN]C.char
+	nvl := C.fnvlist_alloc()
+	defer C.nvlist_free(nvl)
+	recurse := flags.IsRecursiveDestroy || flags.R
+	switch C.dataset_rollback_gather(d.list, snap.list, booleanT(flags.R),
+		nvl, &errname[0], C.ZFS_MAX_DATASET_NAME_LEN) {
+	case 0:
+	case C.DESTROY_HAS_CLONES:
+		err = NewError(EExists, fmt.Sprintf("cannot rollback to '%s': clone '%s' of more recent snapshot exists",
+			spath, C.GoString(&errname[0])))
+		return
+	default:
+		err = LastError()
+		return
+	}
+	for nvp := C.nvlist_next_nvpair(nvl, nil); nvp != nil; nvp = C.nvlist_next_nvpair(nvl, nvp) {
+		destroyed = append(destroyed, C.GoString(C.nvpair_name(nvp)))
+	}
+	if len(destroyed) > 0 && !recurse {
+		err = NewError(EExists, fmt.Sprintf("cannot rollback to '%s': more recent snapshots or bookmarks exist (%s)",
+			spath, destroyed[0]))
+		destroyed = nil
+		return
+	}
+	if flags.IsDryRun {
+		return
+	}
+	if len(destroyed) > 0 {
+		if C.dataset_destroy_list(nvl, booleanT(flags.IsForcedToUnmountClones), C.B_FALSE) != 0 {
+			err = LastError()
+			return
+		}
+	}
+	if errc := C.dataset_rollback(d.list, snap.list, booleanT(flags.IsForcedToUnmountClones)); errc != 0 {
+		err = LastError()
+		return
+	}
+	d.ReloadProperties()
+	return
+}
+
 // Promote promotes dataset clone
 func (d *Dataset) Promote() (err error) {
 	if d.list == nil {
@@ -560,6 +894,68 @@ func (d *Dataset) Rename(newName string, recur,
 	return
 }
 
+// RenameWithFlags rename dataset honouring flags. IsRecursive is valid only
+// for snapshots and renames snapshots of the same name of all descendent
+// filesystems, IsParentCreated is not valid for snapshots.
+func (d *Dataset) RenameWithFlags(newName string, flags *RenameFlags) (err error) {
+	if d.list == nil {
+		err = NewError(EUndefined, msgDatasetIsNil)
+		return
+	}
+	if flags == nil {
+		flags = &RenameFlags{}
+	}
+	isSnapshot := d.Type == DatasetTypeSnapshot
+	switch {
+	case flags.IsRecursive && !isSnapshot:
+		err = NewError(EBadtype, "recursive rename is valid only for snapshots")
+	case flags.IsParentCreated && isSnapshot:
+		err = NewError(EBadtype, "creating parents is not valid for snapshots")
+	case flags.NoUnmount && C.LIBZFS_VERSION_MAJOR < 2:
+		err = NewError(ENotsup, "renaming without unmount is not supported by libzfs")
+	}
+	if err != nil {
+		return
+	}
+	csNewName := C.CString(newName)
+	defer C.free(unsafe.Pointer(csNewName))
+	if errc := C.dataset_rename_ex(d.list, csNewName, booleanT(flags.IsRecursive),
+		booleanT(flags.IsForcedToUnmount), booleanT(flags.NoUnmount),
+		booleanT(flags.IsParentCreated)); errc != 0 {
+		err = LastError()
+		return
+	}
+	d.ReloadProperties()
+	return
+}
+
+// RenameSnapshot rename snapshot oldName (pool/fs@snap) to newName given
+// as full name or as @snap. Snapshot can't be moved to another filesystem.
+// With recursive snapshots of the same name of all descendent filesystems
+// are renamed too.
+func RenameSnapshot(oldName, newName string, recursive bool) (err error) {
+	at := strings.Index(oldName, "@")
+	if at <= 0 {
+		return NewError(EInvalidname, fmt.Sprintf("'%s' is not a snapshot name", oldName))
+	}
+	fsname := oldName[:at]
+	if strings.HasPrefix(newName, "@") {
+		newName = fsname + newName
+	}
+	if i := strings.Index(newName, "@"); i < 0 || i == len(newName)-1 {
+		return NewError(EInvalidname, fmt.Sprintf("'%s' is not a snapshot name", newName))
+	} else if newName[:i] != fsname {
+		return NewError(ECrosstarget,
+			fmt.Sprintf("'%s' is not in the same filesystem as '%s'", newName, oldName))
+	}
+	var snap Dataset
+	if snap, err = DatasetOpenSingle(oldName); err != nil {
+		return
+	}
+	defer snap.Close()
+	return snap.RenameWithFlags(newName, &RenameFlags{IsRecursive: recursive})
+}
+
 // IsMounted checks to see if the mount is active.  If the filesystem is mounted,
 // sets in 'where' argument the current mountpoint, and returns true.  Otherwise,
 // returns false.
@@ -627,63 +1023,19 @@ func (d *Dataset) UnmountAll(flags int) (err error) {
 // Hold - Adds a single reference, named with the tag argument, to the snapshot.
 // Each snapshot has its own tag namespace, and tags must be unique within that space.
 func (d *Dataset) Hold(flag string) (err error) {
-	var path string
-	var pd Dataset
-	if path, err = d.Path(); err != nil {
-		return
-	}
-	if !strings.Contains(path, "@") {
-		err = NewError(EUndefined, fmt.Sprintf("'%s' is not a snapshot", path))
-		return
-	}
-	pd, err = DatasetOpenSingle(path[:strings.Index(path, "@")])
-	if err != nil {
-		return
-	}
-	defer pd.Close()
-	csSnapName := C.CString(path[strings.Index(path, "@")+1:])
-	defer C.free(unsafe.Pointer(csSnapName))
-	csFlag := C.CString(flag)
-	defer C.free(unsafe.Pointer(csFlag))
-	if 0 != C.zfs_hold(pd.list.zh, csSnapName, csFlag, booleanT(false), -1) {
-		err = LastError()
-	}
-	return
+	return d.hold(flag, false)
 }
 
 // Release - Removes a single reference, named with the tag argument, from the specified snapshot.
 // The tag must already exist for each snapshot.  If a hold exists on a snapshot, attempts to destroy
 //  that snapshot by using the zfs destroy command return EBUSY.
 func (d *Dataset) Release(flag string) (err error) {
-	var path string
-	var pd Dataset
-	if path, err = d.Path(); err != nil {
-		return
-	}
-	if !strings.Contains(path, "@") {
-		err = NewError(EUndefined, fmt.Sprintf("'%s' is not a snapshot", path))
-		return
-	}
-	pd, err = DatasetOpenSingle(path[:strings.Index(path, "@")])
-	if err != nil {
-		return
-	}
-	defer pd.Close()
-	csSnapName := C.CString(path[strings.Index(path, "@")+1:])
-	defer C.free(unsafe.Pointer(csSnapName))
-	csFlag := C.CString(flag)
-	defer C.free(unsafe.Pointer(csFlag))
-	if 0 != C.zfs_release(pd.list.zh, csSnapName, csFlag, booleanT(false)) {
-		err = LastError()
-	}
-	return
+	return d.release(flag, false)
 }
 
 // Holds - Lists all existing user references for the given snapshot
 func (d *Dataset) Holds() (tags []HoldTag, err error) {
 	var nvl *C.nvlist_t
-	var nvp *C.nvpair_t
-	var tu64 C.uint64_t
 	var path string
 	if path, err = d.Path(); err != nil {
 		return
@@ -697,17 +1049,7 @@ func (d *Dataset) Holds() (tags []HoldTag, err error) {
 		return
 	}
 	defer C.nvlist_free(nvl)
-	tags = make([]HoldTag, 0, 5)
-	for nvp = C.nvlist_next_nvpair(nvl, nvp); nvp != nil; {
-		tag := C.nvpair_name(nvp)
-		C.nvpair_value_uint64(nvp, &tu64)
-		tags = append(tags, HoldTag{
-			Name:      C.GoString(tag),
-			Timestamp: time.Unix(int64(tu64), 0),
-		})
-
-		nvp = C.nvlist_next_nvpair(nvl, nvp)
-	}
+	tags = holdTags(nvl)
 	return
 }
 
@@ -811,6 +1153,39 @@ func (d *Dataset) Snapshots() (snaps []Dataset, err error) {
 	return
 }
 
+// openSnapshots - open snapshots of dataset (without opening its children)
+// sorted by creation txg, oldest first. Returned datasets have to be closed.
+func (d *Dataset) openSnapshots() (snaps []Dataset, err error) {
+	if d.list == nil {
+		err = NewError(EUndefined, msgDatasetIsNil)
+		return
+	}
+	list := C.dataset_list_children(d.list)
+	for list != nil {
+		next := C.dataset_next(list)
+		dataset := Dataset{list: list}
+		dataset.Type = DatasetType(C.dataset_type(list))
+		if dataset.Type != DatasetTypeSnapshot {
+			dataset.Close()
+			list = next
+			continue
+		}
+		snaps = append(snaps, dataset)
+		if err = snaps[len(snaps)-1].ReloadProperties(); err != nil {
+			for list = next; list != nil; list = next {
+				next = C.dataset_next(list)
+				(&Dataset{list: list}).Close()
+			}
+			DatasetCloseAll(snaps)
+			snaps = nil
+			return
+		}
+		list = next
+	}
+	sort.Sort(snapshotsCreateAsc(snaps))
+	return
+}
+
 // FindSnapshot - returns true if given path is one of dataset snaphsots
 func (d *Dataset) FindSnapshot(path string) (ok bool, snap Dataset) {
 	for _, ch := range d.Children {
@@ -1,5 +1,6 @@
 #include <stdio.h>
 #include <stdlib.h>
+#include <string.h>
 #include <libzfs.h>
 #include "common.h"
 #include "zpool.h"
@@ -34,3 +35,243 @@ void print_list(nvlist_t *pnvl) {
 		__printf("name", nvpair_name(nvp));
 	}
 }
+
+typedef struct destroy_cbdata {
+	nvlist_t *nvl;
+	const char *target;
+	const char *snapname;
+	boolean_t recurse;
+	boolean_t doclones;
+	int reason;
+	char errname[ZFS_MAX_DATASET_NAME_LEN];
+} destroy_cbdata_t;
+
+static boolean_t is_descendant(const char *name, const char *target) {
+	size_t len = strlen(target);
+	return (strncmp(name, target, len) == 0 &&
+		(name[len] == '/' || name[len] == '@' || name[len] == '#'));
+}
+
+static int destroy_gather_dependent(zfs_handle_t *zhp, void *data) {
+	destroy_cbdata_t *cb = (destroy_cbdata_t *)data;
+	const char *name = zfs_get_name(zhp);
+	int reason = 0;
+
+	if (cb->snapname == NULL && is_descendant(name, cb->target)) {
+		if (!cb->recurse) {
+			reason = DESTROY_HAS_CHILDREN;
+		}
+	} else if (!cb->doclones) {
+		reason = DESTROY_HAS_CLONES;
+	}
+	if (reason != 0) {
+		cb->reason = reason;
+		(void) strncpy(cb->errname, name, sizeof (cb->errname) - 1);
+		zfs_close(zhp);
+		return (-1);
+	}
+	fnvlist_add_boolean(cb->nvl, name);
+	zfs_close(zhp);
+	return (0);
+}
+
+static int destroy_gather_snapshot(zfs_handle_t *zhp, void *data) {
+	destroy_cbdata_t *cb = (destroy_cbdata_t *)data;
+	char name[ZFS_MAX_DATASET_NAME_LEN];
+	zfs_handle_t *snap;
+	int err = 0;
+
+	(void) snprintf(name, sizeof (name), "%s@%s", zfs_get_name(zhp), cb->snapname);
+	if (zfs_dataset_exists(libzfs_get_handle(), name, ZFS_TYPE_SNAPSHOT)) {
+		snap = zfs_open(libzfs_get_handle(), name, ZFS_TYPE_SNAPSHOT);
+		if (snap == NULL) {
+			zfs_close(zhp);
+			return (-1);
+		}
+		err = zfs_iter_dependents(snap, B_FALSE, destroy_gather_dependent, cb);
+		if (err == 0) {
+			fnvlist_add_boolean(cb->nvl, name);
+		}
+		zfs_close(snap);
+	}
+	if (err == 0 && cb->recurse) {
+		err = zfs_iter_filesystems(zhp, destroy_gather_snapshot, cb);
+	}
+	zfs_close(zhp);
+	return (err);
+}
+
+/*
+ * Collect names of all datasets 'zfs destroy' would destroy in the order
+ * they have to be destroyed. Returns -1 on libzfs error, or one of
+ * DESTROY_HAS_* reasons with errname set to name of blocking dataset.
+ */
+int dataset_destroy_gather(const char *target, boolean_t recurse, boolean_t doclones,
+	nvlist_ptr names, char *errname, int errlen) {
+	destroy_cbdata_t cb = {0};
+	zfs_handle_t *zhp;
+	char fsname[ZFS_MAX_DATASET_NAME_LEN];
+	char *at;
+	int err;
+
+	cb.nvl = names;
+	cb.target = target;
+	cb.recurse = recurse || doclones;
+	cb.doclones = doclones;
+
+	(void) strncpy(fsname, target, sizeof (fsname) - 1);
+	fsname[sizeof (fsname) - 1] = '\0';
+	if ((at = strchr(fsname, '@')) != NULL) {
+		*at = '\0';
+		cb.snapname = at + 1;
+		cb.target = fsname;
+		zhp = zfs_open(libzfs_get_handle(), fsname,
+			ZFS_TYPE_FILESYSTEM | ZFS_TYPE_VOLUME);
+		if (zhp == NULL) {
+			return (-1);
+		}
+		err = destroy_gather_snapshot(zhp, &cb);
+	} else {
+		zhp = zfs_open(libzfs_get_handle(), target,
+			ZFS_TYPE_FILESYSTEM | ZFS_TYPE_VOLUME | ZFS_TYPE_BOOKMARK);
+		if (zhp == NULL) {
+			return (-1);
+		}
+		err = 0;
+		if (zfs_get_type(zhp) != ZFS_TYPE_BOOKMARK) {
+			err = zfs_iter_dependents(zhp, B_FALSE, destroy_gather_dependent, &cb);
+		}
+		if (err == 0) {
+			fnvlist_add_boolean(names, target);
+		}
+		zfs_close(zhp);
+	}
+	if (err != 0 && cb.reason != 0) {
+		(void) strncpy(errname, cb.errname, errlen - 1);
+		errname[errlen - 1] = '\0';
+		return (cb.reason);
+	}
+	return (err != 0 ? -1 : 0);
+}
+
+/*
+ * Destroy datasets in given order, contiguous snapshots (even of different
+ * filesystems) are batched and destroyed with one ioctl, like zfs destroy does.
+ */
+int dataset_destroy_list(nvlist_ptr names, boolean_t force, boolean_t defer) {
+	nvlist_t *batchedsnaps = fnvlist_alloc();
+	nvpair_t *nvp = NULL;
+	zfs_handle_t *zhp;
+	int err = 0;
+
+	while (err == 0 && (nvp = nvlist_next_nvpair(names, nvp)) != NULL) {
+		const char *name = nvpair_name(nvp);
+		if (strchr(name, '@') != NULL) {
+			fnvlist_add_boolean(batchedsnaps, name);
+			continue;
+		}
+		if (!nvlist_empty(batchedsnaps)) {
+			err = zfs_destroy_snaps_nvl(libzfs_get_handle(), batchedsnaps, defer);
+			fnvlist_free(batchedsnaps);
+			batchedsnaps = fnvlist_alloc();
+			if (err != 0) {
+				break;
+			}
+		}
+		zhp = zfs_open(libzfs_get_handle(), name,
+			ZFS_TYPE_FILESYSTEM | ZFS_TYPE_VOLUME | ZFS_TYPE_BOOKMARK);
+		if (zhp == NULL) {
+			err = -1;
+			break;
+		}
+		if (zfs_get_type(zhp) == ZFS_TYPE_FILESYSTEM &&
+			zfs_unmount(zhp, NULL, force ? MS_FORCE : 0) != 0) {
+			err = -1;
+		} else if (zfs_destroy(zhp, defer) != 0) {
+			err = -1;
+		}
+		zfs_close(zhp);
+	}
+	if (err == 0 && !nvlist_empty(batchedsnaps)) {
+		err = zfs_destroy_snaps_nvl(libzfs_get_handle(), batchedsnaps, defer);
+	}
+	fnvlist_free(batchedsnaps);
+	return (err);
+}
+
+static int snapshot_gather_cb(zfs_handle_t *zhp, void *arg) {
+	nvlist_t *nvl = (nvlist_t *)arg;
+	fnvlist_add_boolean(nvl, zfs_get_name(zhp));
+	zfs_close(zhp);
+	return (0);
+}
+
+/*
+ * Resolve snapshots of filesystem matching spec e.g. "snap1%snap5,snap7"
+ */
+int dataset_snapspec_gather(const char *fsname, const char *spec, nvlist_ptr names) {
+	int err;
+	zfs_handle_t *zhp = zfs_open(libzfs_get_handle(), fsname,
+		ZFS_TYPE_FILESYSTEM | ZFS_TYPE_VOLUME);
+	if (zhp == NULL) {
+		return (-1);
+	}
+	err = zfs_iter_snapspec(zhp, spec, snapshot_gather_cb, names);
+	zfs_close(zhp);
+	if (err == ENOENT) {
+		/* some of snapshots in spec don't exist */
+		err = 0;
+	}
+	return (err);
+}
+
+typedef struct rollback_cbdata {
+	destroy_cbdata_t destroy;
+	uint64_t create_txg;
+} rollback_cbdata_t;
+
+static int rollback_gather_cb(zfs_handle_t *zhp, void *data) {
+	rollback_cbdata_t *cb = (rollback_cbdata_t *)data;
+	zfs_type_t type = zfs_get_type(zhp);
+	int err = 0;
+
+	if ((type == ZFS_TYPE_SNAPSHOT || type == ZFS_TYPE_BOOKMARK) &&
+		zfs_prop_get_int(zhp, ZFS_PROP_CREATETXG) > cb->create_txg) {
+		if (type == ZFS_TYPE_SNAPSHOT) {
+			err = zfs_iter_dependents(zhp, B_FALSE, destroy_gather_dependent, &cb->destroy);
+		}
+		if (err == 0) {
+			fnvlist_add_boolean(cb->destroy.nvl, zfs_get_name(zhp));
+		}
+	}
+	zfs_close(zhp);
+	return (err);
+}
+
+/*
+ * Collect snapshots and bookmarks more recent than snapshot, and with
+ * doclones their dependent clones, 'zfs rollback -r' would destroy.
+ * Returns -1 on libzfs error or DESTROY_HAS_CLONES with errname set.
+ */
+int dataset_rollback_gather(dataset_list_ptr dataset, dataset_list_ptr snapshot,
+	boolean_t doclones, nvlist_ptr names, char *errname, int errlen) {
+	rollback_cbdata_t cb = {{0}};
+	int err;
+
+	cb.destroy.nvl = names;
+	cb.destroy.target = zfs_get_name(dataset->zh);
+	cb.destroy.snapname = zfs_get_name(snapshot->zh);
+	cb.destroy.doclones = doclones;
+	cb.create_txg = zfs_prop_get_int(snapshot->zh, ZFS_PROP_CREATETXG);
+
+	err = zfs_iter_children(dataset->zh, rollback_gather_cb, &cb);
+	if (err == 0) {
+		err = zfs_iter_bookmarks(dataset->zh, rollback_gather_cb, &cb);
+	}
+	if (err != 0 && cb.destroy.reason != 0) {
+		(void) strncpy(errname, cb.destroy.errname, errlen - 1);
+		errname[errlen - 1] = '\0';
+		return (cb.destroy.reason);
+	}
+	return (err != 0 ? -1 : 0);
+}
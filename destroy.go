@@ -3,6 +3,7 @@ package zfs
 // #include <stdio.h>
 // #include <stdlib.h>
 // #include <libzfs.h>
+// #include <libzfs_core.h>
 // #include "common.h"
 // #include "zpool.h"
 // #include "zfs.h"
@@ -14,6 +15,7 @@ import "C"
 import (
 	"strings"
 	"fmt"
+	"syscall"
 	"unsafe"
 )
 
@@ -61,3 +63,253 @@ func DestroySnapshot(pathname string) (err error) {
 
 	return nil
 }
+
+// DestroyResult - datasets destroyed (or would be destroyed on dry run) in
+// order of destruction, and space reclaimed by destroying them
+type DestroyResult struct {
+	Datasets  []string `json:"datasets"`
+	Reclaimed uint64   `json:"reclaimed"`
+}
+
+// DestroyWithFlags destroys the dataset the way zfs destroy does. With
+// IsChildrenRecursive (-r) all descendent datasets are destroyed, with
+// IsDependentRecursive (-R) also all dependents including clones outside
+// of the dataset hierarchy. IsForcedToUnmount (-f) forces unmount of
+// mounted filesystems. With IsDryRun (-n) nothing is destroyed and only
+// the result is returned. On snapshot, -r destroys snapshots of same name
+// in descendent filesystems. Result always lists datasets, VerboseInfo
+// has no effect. Dataset and its children have to be closed with Close()
+// after all.
+func (d *Dataset) DestroyWithFlags(flags *DestroyFlags) (res DestroyResult, err error) {
+	var dpath string
+	if flags == nil {
+		flags = &DestroyFlags{}
+	}
+	if dpath, err = d.Path(); err != nil {
+		return
+	}
+	if !strings.ContainsAny(dpath, "/@#") {
+		err = NewError(EBadtype, fmt.Sprintf("cannot destroy '%s': operation does not apply to pools", dpath))
+		return
+	}
+	nvl := C.fnvlist_alloc()
+	defer C.nvlist_free(nvl)
+	if res.Datasets, err = destroyGather(dpath, flags, nvl); err != nil {
+		return
+	}
+	res.Reclaimed = destroyReclaimed(res.Datasets)
+	if flags.IsDryRun {
+		return
+	}
+	if C.dataset_destroy_list(nvl, booleanT(flags.IsForcedToUnmount), C.B_FALSE) != 0 {
+		err = LastError()
+		return
+	}
+	// close handles of destroyed children
+	for _, c := range d.Children {
+		c.Close()
+	}
+	d.Children = make([]Dataset, 0)
+	return
+}
+
+func destroyGather(dpath string, flags *DestroyFlags, nvl *C.nvlist_t) (names []string, err error) {
+	var errname [C.ZFS_MAX_DATASET_NAME_LEN]C.char
+	csPath := C.CString(dpath)
+	defer C.free(unsafe.Pointer(csPath))
+	rc := C.dataset_destroy_gather(csPath, booleanT(flags.IsChildrenRecursive),
+		booleanT(flags.IsDependentRecursive), nvl, &errname[0], C.ZFS_MAX_DATASET_NAME_LEN)
+	switch rc {
+	case 0:
+	case C.DESTROY_HAS_CHILDREN:
+		err = NewError(EExists, fmt.Sprintf("cannot destroy '%s': filesystem has children (%s), use recursive destroy",
+			dpath, C.GoString(&errname[0])))
+		return
+	case C.DESTROY_HAS_CLONES:
+		err = NewError(EExists, fmt.Sprintf("cannot destroy '%s': filesystem has dependent clones (%s), use dependent recursive destroy",
+			dpath, C.GoString(&errname[0])))
+		return
+	default:
+		err = LastError()
+		return
+	}
+	for nvp := C.nvlist_next_nvpair(nvl, nil); nvp != nil; nvp = C.nvlist_next_nvpair(nvl, nvp) {
+		names = append(names, C.GoString(C.nvpair_name(nvp)))
+	}
+	return
+}
+
+// destroyReclaimed - sum used space of datasets which are not descendants
+// of other destroyed dataset, used of filesystem or volume already
+// counts its children and snapshots
+func destroyReclaimed(names []string) (reclaimed uint64) {
+	destroyed := make(map[string]bool, len(names))
+	for _, name := range names {
+		destroyed[name] = true
+	}
+	for _, name := range names {
+		if isDescendantOfAny(name, destroyed) {
+			continue
+		}
+		csName := C.CString(name)
+		zhp := C.zfs_open(C.libzfs_get_handle(), csName,
+			C.ZFS_TYPE_FILESYSTEM|C.ZFS_TYPE_VOLUME|C.ZFS_TYPE_SNAPSHOT)
+		C.free(unsafe.Pointer(csName))
+		if zhp == nil {
+			continue
+		}
+		reclaimed += uint64(C.zfs_prop_get_int(zhp, C.ZFS_PROP_USED))
+		C.zfs_close(zhp)
+	}
+	return
+}
+
+func isDescendantOfAny(name string, datasets map[string]bool) bool {
+	if i := strings.IndexAny(name, "@#"); i >= 0 {
+		if datasets[name[:i]] {
+			return true
+		}
+		name = name[:i]
+	}
+	for i := strings.LastIndex(name, "/"); i > 0; i = strings.LastIndex(name, "/") {
+		name = name[:i]
+		if datasets[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// SnapshotDestroyItem - snapshot resolved from snapshot spec, with user
+// holds and clones which would block its destruction
+type SnapshotDestroyItem struct {
+	Name   string   `json:"name"`
+	Holds  []string `json:"holds,omitempty"`
+	Clones []string `json:"clones,omitempty"`
+}
+
+// IsBlocked - true if snapshot can be destroyed only deferred
+func (item SnapshotDestroyItem) IsBlocked() bool {
+	return len(item.Holds) > 0 || len(item.Clones) > 0
+}
+
+// SnapshotDestroyPlan - snapshots to destroy resolved from snapshot spec
+type SnapshotDestroyPlan struct {
+	Filesystem  string                `json:"filesystem"`
+	Snapshots   []SnapshotDestroyItem `json:"snapshots"` // oldest first
+	Reclaimable uint64                `json:"reclaimable"`
+}
+
+// PlanSnapshotDestroy resolve snapshot spec (e.g. pool/fs@snap1%snap5,snap7)
+// the same way DestroySnapshot does, without destroying anything. Call
+// Execute on returned plan to destroy resolved snapshots.
+func PlanSnapshotDestroy(spec string) (plan SnapshotDestroyPlan, err error) {
+	at := strings.Index(spec, "@")
+	if at == -1 {
+		err = NewError(EBadtype, C.GoString(C.libzfs_strerrno(C.EZFS_BADTYPE)))
+		return
+	}
+	plan.Filesystem = spec[:at]
+	nvl := C.fnvlist_alloc()
+	defer C.nvlist_free(nvl)
+	csFs := C.CString(plan.Filesystem)
+	defer C.free(unsafe.Pointer(csFs))
+	csSpec := C.CString(spec[at+1:])
+	defer C.free(unsafe.Pointer(csSpec))
+	if C.dataset_snapspec_gather(csFs, csSpec, nvl) != 0 {
+		err = LastError()
+		return
+	}
+	if C.nvlist_empty(nvl) == C.B_TRUE {
+		err = NewError(ENoent, "could not find any snapshots to destroy; check snapshot names.")
+		return
+	}
+
+	var fs Dataset
+	var snaps []Dataset
+	if fs, err = DatasetOpenSingle(plan.Filesystem); err != nil {
+		return
+	}
+	defer fs.Close()
+	if snaps, err = fs.openSnapshots(); err != nil {
+		return
+	}
+	defer DatasetCloseAll(snaps)
+
+	// sum space of each contiguous range of resolved snapshots
+	var first, prev string
+	for i := range snaps {
+		name := snaps[i].Properties[DatasetPropName].Value
+		csName := C.CString(name)
+		selected := C.nvlist_exists(nvl, csName) == C.B_TRUE
+		C.free(unsafe.Pointer(csName))
+		if selected {
+			item := SnapshotDestroyItem{Name: name}
+			var tags []HoldTag
+			if tags, err = snaps[i].Holds(); err != nil {
+				return
+			}
+			for _, tag := range tags {
+				item.Holds = append(item.Holds, tag.Name)
+			}
+			if clones := snaps[i].Properties[DatasetPropClones].Value; len(clones) > 0 && clones != "-" {
+				item.Clones = strings.Split(clones, ",")
+			}
+			plan.Snapshots = append(plan.Snapshots, item)
+			if len(first) == 0 {
+				first = name
+			}
+			prev = name
+			continue
+		}
+		if len(first) > 0 {
+			if err = plan.addRangeSpace(first, prev); err != nil {
+				return
+			}
+			first = ""
+		}
+	}
+	if len(first) > 0 {
+		err = plan.addRangeSpace(first, prev)
+	}
+	return
+}
+
+func (plan *SnapshotDestroyPlan) addRangeSpace(first, last string) (err error) {
+	var used C.uint64_t
+	csFirst := C.CString(first)
+	defer C.free(unsafe.Pointer(csFirst))
+	csLast := C.CString(last)
+	defer C.free(unsafe.Pointer(csLast))
+	if rc := C.lzc_snaprange_space(csFirst, csLast, &used); rc != 0 {
+		err = NewError(EUndefined, fmt.Sprintf("cannot estimate space of '%s%%%s': %s",
+			first, last[strings.Index(last, "@")+1:], syscall.Errno(rc).Error()))
+		return
+	}
+	plan.Reclaimable += uint64(used)
+	return
+}
+
+// Execute destroys all snapshots of the plan in one batch. Without deferDestroy
+// it fails if any of snapshots is blocked by hold or clone, with deferDestroy
+// blocked snapshots are marked for deferred destruction.
+func (plan *SnapshotDestroyPlan) Execute(deferDestroy bool) (err error) {
+	if len(plan.Snapshots) == 0 {
+		return NewError(ENoent, "could not find any snapshots to destroy; check snapshot names.")
+	}
+	nvl := C.fnvlist_alloc()
+	defer C.nvlist_free(nvl)
+	for _, item := range plan.Snapshots {
+		if !deferDestroy && item.IsBlocked() {
+			return NewError(EBusy, fmt.Sprintf("cannot destroy '%s': snapshot has holds %v or clones %v",
+				item.Name, item.Holds, item.Clones))
+		}
+		csName := C.CString(item.Name)
+		C.fnvlist_add_boolean(nvl, csName)
+		C.free(unsafe.Pointer(csName))
+	}
+	if C.zfs_destroy_snaps_nvl(C.libzfs_get_handle(), nvl, booleanT(deferDestroy)) != 0 {
+		err = LastError()
+	}
+	return
+}
@@ -9,3 +9,33 @@ func TestDestroySnapshot(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestPlanSnapshotDestroy(t *testing.T) {
+	datasetName := *testPool + "/snapplan"
+	d, err := DatasetCreate(datasetName, DatasetTypeFilesystem, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		d.DestroyWithFlags(&DestroyFlags{IsChildrenRecursive: true})
+		d.Close()
+	}()
+	for _, name := range []string{"@s1", "@s2", "@s3", "@s4"} {
+		s, err := DatasetSnapshot(datasetName+name, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+	}
+	plan, err := PlanSnapshotDestroy(datasetName + "@s1%s2,s4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Snapshots) != 3 || plan.Snapshots[2].Name != datasetName+"@s4" {
+		t.Fatalf("wrong plan %v", plan)
+	}
+	t.Log(plan)
+	if err = plan.Execute(false); err != nil {
+		t.Fatal(err)
+	}
+}
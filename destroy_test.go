@@ -88,3 +88,43 @@ func TestDataset_DestroyPromote(t *testing.T) {
 	t.Log("Destroy promote completed with success")
 	d.Close()
 }
+
+func TestDataset_DestroyWithFlags(t *testing.T) {
+	datasetName := *testPool + "/destroyflags"
+	d, err := DatasetCreate(datasetName, DatasetTypeFilesystem, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	c, err := DatasetCreate(datasetName+"/child", DatasetTypeFilesystem, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	s, err := DatasetSnapshot(datasetName+"@snap", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	t.Run("refuse to destroy dataset with children", func(t *testing.T) {
+		if _, err := d.DestroyWithFlags(&DestroyFlags{}); err == nil {
+			t.Fatal("have to return an error")
+		}
+	})
+	t.Run("dry run", func(t *testing.T) {
+		res, err := d.DestroyWithFlags(&DestroyFlags{IsChildrenRecursive: true, IsDryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Datasets) != 4 || res.Datasets[len(res.Datasets)-1] != datasetName {
+			t.Errorf("wrong datasets to destroy %v", res.Datasets)
+		}
+		t.Log(res)
+	})
+	t.Run("destroy recursive", func(t *testing.T) {
+		if _, err := d.DestroyWithFlags(&DestroyFlags{IsChildrenRecursive: true}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
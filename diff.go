@@ -0,0 +1,269 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "common.h"
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// DiffChangeType - kind of change reported by zfs diff
+type DiffChangeType byte
+
+const (
+	// DiffAdded - path was added
+	DiffAdded DiffChangeType = '+'
+	// DiffRemoved - path was removed
+	DiffRemoved DiffChangeType = '-'
+	// DiffModified - path was modified
+	DiffModified DiffChangeType = 'M'
+	// DiffRenamed - path was renamed
+	DiffRenamed DiffChangeType = 'R'
+)
+
+func (c DiffChangeType) String() string {
+	switch c {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffModified:
+		return "modified"
+	case DiffRenamed:
+		return "renamed"
+	}
+	return "unknown"
+}
+
+// DiffFileType - type of the file reported by zfs diff
+type DiffFileType byte
+
+const (
+	DiffFileBlock     DiffFileType = 'B' // block device
+	DiffFileChar      DiffFileType = 'C' // character device
+	DiffFileDirectory DiffFileType = '/' // directory
+	DiffFileDoor      DiffFileType = '>' // door
+	DiffFileFifo      DiffFileType = '|' // named pipe
+	DiffFileSymlink   DiffFileType = '@' // symbolic link
+	DiffFileEventPort DiffFileType = 'P' // event port
+	DiffFileSocket    DiffFileType = '=' // socket
+	DiffFileRegular   DiffFileType = 'F' // regular file
+	DiffFileUnknown   DiffFileType = '?' // unknown
+)
+
+// DiffRecord - single change between two snapshots
+type DiffRecord struct {
+	Change    DiffChangeType `json:"change"`
+	FileType  DiffFileType   `json:"file_type"`
+	Path      string         `json:"path"`
+	NewPath   string         `json:"new_path,omitempty"`   // set only for DiffRenamed
+	LinkDelta int            `json:"link_delta,omitempty"` // link count change of modified path
+	CTime     time.Time      `json:"ctime"` // inode change time
+}
+
+// DiffOptions - zfs diff options
+type DiffOptions struct {
+	// Context cancels delivery of records, defaults to context.Background()
+	Context context.Context
+	// Buffer is capacity of returned records channel
+	Buffer int
+}
+
+// Diff - report changes between dataset snapshot and toSnapshot as a stream of
+// records. toSnapshot can be full snapshot path, '@name' of snapshot in same
+// filesystem or empty to compare with current state of filesystem.
+// Records channel is closed when diff is finished, after that exactly one
+// value (nil on success) is sent to error channel. On context cancellation
+// ctx.Err() is reported, while libzfs finishes in background since
+// zfs_show_diffs can't be interrupted.
+func (d *Dataset) Diff(toSnapshot string, opts DiffOptions) (<-chan DiffRecord, <-chan error) {
+	records := make(chan DiffRecord, opts.Buffer)
+	errc := make(chan error, 1)
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	fromsnap, fsname, tosnap, err := d.diffNames(toSnapshot)
+	if err != nil {
+		close(records)
+		errc <- err
+		return records, errc
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		close(records)
+		errc <- err
+		return records, errc
+	}
+
+	showerr := make(chan error, 1)
+	go func() {
+		showerr <- diffShow(fsname, fromsnap, tosnap, w)
+		w.Close()
+	}()
+
+	go func() {
+		defer close(records)
+		err := diffParse(ctx, r, records)
+		if err != nil {
+			// let libzfs finish writing, we are not interested in rest
+			go func() {
+				io.Copy(ioutil.Discard, r)
+				r.Close()
+				<-showerr
+			}()
+			errc <- err
+			return
+		}
+		r.Close()
+		errc <- <-showerr
+	}()
+	return records, errc
+}
+
+// diffNames - resolve full names of from and to snapshot and name of
+// filesystem they belongs to
+func (d *Dataset) diffNames(toSnapshot string) (fromsnap, fsname, tosnap string, err error) {
+	if fromsnap, err = d.Path(); err != nil {
+		return
+	}
+	at := strings.Index(fromsnap, "@")
+	if at < 0 {
+		err = NewError(EBadtype, fmt.Sprintf("'%s' is not a snapshot", fromsnap))
+		return
+	}
+	fsname = fromsnap[:at]
+	switch {
+	case len(toSnapshot) == 0:
+		tosnap = fsname
+	case toSnapshot[0] == '@':
+		tosnap = fsname + toSnapshot
+	default:
+		tosnap = toSnapshot
+		if i := strings.Index(tosnap, "@"); i >= 0 && tosnap[:i] != fsname {
+			err = NewError(ECrosstarget,
+				fmt.Sprintf("'%s' is not in the same filesystem as '%s'", tosnap, fromsnap))
+			return
+		}
+	}
+	return
+}
+
+func diffShow(fsname, fromsnap, tosnap string, w *os.File) (err error) {
+	csFs := C.CString(fsname)
+	defer C.free(unsafe.Pointer(csFs))
+	csFrom := C.CString(fromsnap)
+	defer C.free(unsafe.Pointer(csFrom))
+	csTo := C.CString(tosnap)
+	defer C.free(unsafe.Pointer(csTo))
+
+	zhp := C.zfs_open(C.libzfs_get_handle(), csFs, C.ZFS_TYPE_FILESYSTEM)
+	if zhp == nil {
+		return LastError()
+	}
+	defer C.zfs_close(zhp)
+	flags := C.ZFS_DIFF_PARSABLE | C.ZFS_DIFF_TIMESTAMP | C.ZFS_DIFF_CLASSIFY
+	if C.zfs_show_diffs(zhp, C.int(w.Fd()), csFrom, csTo, C.int(flags)) != 0 {
+		err = LastError()
+	}
+	return
+}
+
+func diffParse(ctx context.Context, r io.Reader, records chan<- DiffRecord) (err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var rec DiffRecord
+		if rec, err = parseDiffLine(scanner.Text()); err != nil {
+			return
+		}
+		select {
+		case records <- rec:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return scanner.Err()
+}
+
+// parseDiffLine - parse single line of parsable, timestamped and classified
+// zfs diff output:
+// <sec>.<nsec>\t<change>\t<type>\t<path>[\t<new path>|\t(<link delta>)]
+func parseDiffLine(line string) (rec DiffRecord, err error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 4 || len(fields[1]) != 1 || len(fields[2]) != 1 {
+		err = NewError(EDiffdata, fmt.Sprintf("invalid diff line '%s'", line))
+		return
+	}
+	ts := strings.SplitN(strings.TrimSpace(fields[0]), ".", 2)
+	var sec, nsec int64
+	if sec, err = strconv.ParseInt(ts[0], 10, 64); err != nil {
+		err = NewError(EDiffdata, fmt.Sprintf("invalid diff timestamp '%s'", fields[0]))
+		return
+	}
+	if len(ts) > 1 {
+		if nsec, err = strconv.ParseInt(ts[1], 10, 64); err != nil {
+			err = NewError(EDiffdata, fmt.Sprintf("invalid diff timestamp '%s'", fields[0]))
+			return
+		}
+	}
+	rec.CTime = time.Unix(sec, nsec)
+	rec.Change = DiffChangeType(fields[1][0])
+	rec.FileType = DiffFileType(fields[2][0])
+	if rec.Path, err = unescapeDiffPath(fields[3]); err != nil {
+		return
+	}
+	if len(fields) > 4 {
+		extra := fields[4]
+		switch rec.Change {
+		case DiffRenamed:
+			rec.NewPath, err = unescapeDiffPath(extra)
+		case DiffModified:
+			if strings.HasPrefix(extra, "(") && strings.HasSuffix(extra, ")") {
+				rec.LinkDelta, err = strconv.Atoi(strings.TrimPrefix(extra[1:len(extra)-1], "+"))
+			}
+		}
+		if err != nil {
+			err = NewError(EDiffdata, fmt.Sprintf("invalid diff line '%s'", line))
+		}
+	}
+	return
+}
+
+// unescapeDiffPath - libzfs escapes non printable characters, spaces and
+// backslashes in diff paths as 4 digit \0ooo octal sequences (stream_bytes
+// prints them with "\\%04o")
+func unescapeDiffPath(s string) (string, error) {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, nil
+	}
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf = append(buf, s[i])
+			continue
+		}
+		if i+5 > len(s) {
+			return "", NewError(EDiffdata, fmt.Sprintf("invalid escape sequence in '%s'", s))
+		}
+		c, err := strconv.ParseUint(s[i+1:i+5], 8, 8)
+		if err != nil {
+			return "", NewError(EDiffdata, fmt.Sprintf("invalid escape sequence in '%s'", s))
+		}
+		buf = append(buf, byte(c))
+		i += 4
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,62 @@
+package zfs
+
+import (
+	"testing"
+)
+
+func TestParseDiffLine(t *testing.T) {
+	t.Run("renamed path with escaped space", func(t *testing.T) {
+		rec, err := parseDiffLine("1600000000.000000123\tR\tF\t/fs/a\\0040b\t/fs/c\\0134d\\0303\\0251")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Change != DiffRenamed || rec.FileType != DiffFileRegular {
+			t.Errorf("wrong change or file type %c %c", rec.Change, rec.FileType)
+		}
+		if rec.Path != "/fs/a b" || rec.NewPath != "/fs/c\\dé" {
+			t.Errorf("wrong paths '%s' -> '%s'", rec.Path, rec.NewPath)
+		}
+		if rec.CTime.Unix() != 1600000000 || rec.CTime.Nanosecond() != 123 {
+			t.Errorf("wrong ctime %v", rec.CTime)
+		}
+	})
+	t.Run("modified directory link count", func(t *testing.T) {
+		rec, err := parseDiffLine("1600000000.000000000\tM\t/\t/fs/dir\t(+1)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Change != DiffModified || rec.LinkDelta != 1 {
+			t.Errorf("wrong record %+v", rec)
+		}
+	})
+	t.Run("invalid line", func(t *testing.T) {
+		if _, err := parseDiffLine("garbage"); err == nil {
+			t.Error("have to return an error")
+		}
+	})
+}
+
+func TestDatasetDiff(t *testing.T) {
+	testDatasetName := *testPool + "/diff"
+	d, err := DatasetCreate(testDatasetName, DatasetTypeFilesystem, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		d.DestroyRecursive()
+		d.Close()
+	}()
+	snap, err := DatasetSnapshot(testDatasetName+"@diff1", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	records, errc := snap.Diff("", DiffOptions{})
+	for rec := range records {
+		t.Log(rec.Change, string(rec.FileType), rec.Path, rec.NewPath)
+	}
+	if err = <-errc; err != nil {
+		t.Error(err)
+	}
+}
@@ -1,5 +1,11 @@
 package zfs
 
+import (
+	"sort"
+	"strings"
+	"syscall"
+)
+
 type ErrorCode int
 
 const (
@@ -101,3 +107,79 @@ func NewError(errcode ErrorCode, msg string) error {
 	}
 }
 
+// BatchError - error of operation over several named items at once
+// (properties, snapshots, ...), Errors maps name of each failed item to its
+// error. Err is set when failure can't be attributed to single item.
+type BatchError struct {
+	Errors	map[string]error
+	Err		error
+}
+
+// PropertiesError - error of setting several properties at once
+type PropertiesError = BatchError
+
+func (self *BatchError) Error() string {
+	if self.Err != nil {
+		return self.Err.Error()
+	}
+	names := self.names()
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, name + ": " + self.Errors[name].Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ErrorCode - code of whole operation error or of first failed item
+func (self *BatchError) ErrorCode() ErrorCode {
+	err := self.Err
+	if err == nil && len(self.Errors) > 0 {
+		err = self.Errors[self.names()[0]]
+	}
+	if zerr, ok := err.(*Error); ok {
+		return zerr.ErrorCode()
+	}
+	return EUndefined
+}
+
+func (self *BatchError) names() []string {
+	names := make([]string, 0, len(self.Errors))
+	for name := range self.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// errnoError - convert errno returned by libzfs_core to Error
+func errnoError(errno syscall.Errno, msg string) error {
+	code := EUndefined
+	switch errno {
+	case syscall.ENOMEM:
+		code = ENomem
+	case syscall.EEXIST:
+		code = EExists
+	case syscall.ENOENT:
+		code = ENoent
+	case syscall.EBUSY:
+		code = EBusy
+	case syscall.ENOSPC, syscall.EDQUOT:
+		code = ENospc
+	case syscall.EPERM, syscall.EACCES:
+		code = EPerm
+	case syscall.EXDEV:
+		code = ECrosstarget
+	case syscall.ENAMETOOLONG:
+		code = ENametoolong
+	case syscall.ENOTSUP:
+		code = ENotsup
+	case syscall.EINVAL:
+		code = EInvalidname
+	case syscall.EIO:
+		code = EIo
+	}
+	if len(msg) > 0 {
+		msg += ": "
+	}
+	return NewError(code, msg + errno.Error())
+}
@@ -0,0 +1,61 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <libzfs.h>
+#include "common.h"
+#include "zpool.h"
+#include "zfs.h"
+
+typedef struct holds_cbdata {
+	nvlist_t *holds;
+	boolean_t recursive;
+	int err;
+} holds_cbdata_t;
+
+static int holds_gather_snapshot(zfs_handle_t *zhp, void *data) {
+	holds_cbdata_t *cb = (holds_cbdata_t *)data;
+	nvlist_t *nvl = NULL;
+
+	/* skip snapshots without user holds, zfs_get_holds is ioctl per snapshot */
+	if (zfs_prop_get_int(zhp, ZFS_PROP_USERREFS) > 0) {
+		if (zfs_get_holds(zhp, &nvl) != 0) {
+			cb->err = -1;
+		} else {
+			fnvlist_add_nvlist(cb->holds, zfs_get_name(zhp), nvl);
+			nvlist_free(nvl);
+		}
+	}
+	zfs_close(zhp);
+	return (cb->err);
+}
+
+static int holds_gather_dataset(zfs_handle_t *zhp, holds_cbdata_t *cb);
+
+static int holds_gather_child(zfs_handle_t *zhp, void *data) {
+	int err = holds_gather_dataset(zhp, (holds_cbdata_t *)data);
+	zfs_close(zhp);
+	return (err);
+}
+
+static int holds_gather_dataset(zfs_handle_t *zhp, holds_cbdata_t *cb) {
+	int err;
+
+#if LIBZFS_VERSION_MAJOR >= 2
+	err = zfs_iter_snapshots(zhp, B_FALSE, holds_gather_snapshot, cb, 0, 0);
+#else
+	err = zfs_iter_snapshots(zhp, B_FALSE, holds_gather_snapshot, cb);
+#endif
+	if (err == 0 && cb->recursive) {
+		err = zfs_iter_filesystems(zhp, holds_gather_child, cb);
+	}
+	return (err);
+}
+
+/*
+ * Gather user holds of all snapshots of dataset (and its descendants if
+ * recursive) into holds as snapshot name -> { tag -> timestamp }
+ */
+int dataset_holds_gather(dataset_list_ptr dataset, boolean_t recursive, nvlist_ptr holds) {
+	holds_cbdata_t cb = { holds, recursive, 0 };
+	return (holds_gather_dataset(dataset->zh, &cb));
+}
@@ -0,0 +1,212 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include <libzfs_core.h>
+// #include "common.h"
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// HoldCleanup - cleanup file descriptor for temporary holds. Holds created
+// with it are released when it is closed or the process exits.
+type HoldCleanup struct {
+	f *os.File
+}
+
+// OpenHoldCleanup opens new cleanup file descriptor for temporary holds
+func OpenHoldCleanup() (cleanup *HoldCleanup, err error) {
+	var f *os.File
+	if f, err = os.OpenFile("/dev/zfs", os.O_RDWR|os.O_EXCL, 0); err != nil {
+		return
+	}
+	cleanup = &HoldCleanup{f: f}
+	return
+}
+
+// Close releases all temporary holds created with cleanup
+func (c *HoldCleanup) Close() error {
+	return c.f.Close()
+}
+
+func (c *HoldCleanup) fd() C.int {
+	if c == nil {
+		return -1
+	}
+	return C.int(c.f.Fd())
+}
+
+// snapshotParent - open filesystem of snapshot d and return it with
+// short snapshot name
+func (d *Dataset) snapshotParent() (pd Dataset, snapName string, err error) {
+	var path string
+	if path, err = d.Path(); err != nil {
+		return
+	}
+	at := strings.Index(path, "@")
+	if at < 0 {
+		err = NewError(EUndefined, fmt.Sprintf("'%s' is not a snapshot", path))
+		return
+	}
+	pd, err = DatasetOpenSingle(path[:at])
+	snapName = path[at+1:]
+	return
+}
+
+func (d *Dataset) hold(tag string, recursive bool) (err error) {
+	var pd Dataset
+	var snapName string
+	if pd, snapName, err = d.snapshotParent(); err != nil {
+		return
+	}
+	defer pd.Close()
+	csSnapName := C.CString(snapName)
+	defer C.free(unsafe.Pointer(csSnapName))
+	csTag := C.CString(tag)
+	defer C.free(unsafe.Pointer(csTag))
+	if 0 != C.zfs_hold(pd.list.zh, csSnapName, csTag, booleanT(recursive), -1) {
+		err = LastError()
+	}
+	return
+}
+
+func (d *Dataset) release(tag string, recursive bool) (err error) {
+	var pd Dataset
+	var snapName string
+	if pd, snapName, err = d.snapshotParent(); err != nil {
+		return
+	}
+	defer pd.Close()
+	csSnapName := C.CString(snapName)
+	defer C.free(unsafe.Pointer(csSnapName))
+	csTag := C.CString(tag)
+	defer C.free(unsafe.Pointer(csTag))
+	if 0 != C.zfs_release(pd.list.zh, csSnapName, csTag, booleanT(recursive)) {
+		err = LastError()
+	}
+	return
+}
+
+// HoldRecursive - Adds reference named tag to the snapshot and to snapshots
+// of the same name of all descendent filesystems (zfs hold -r).
+func (d *Dataset) HoldRecursive(tag string) error {
+	return d.hold(tag, true)
+}
+
+// ReleaseRecursive - Removes reference named tag from the snapshot and from
+// snapshots of the same name of all descendent filesystems (zfs release -r).
+func (d *Dataset) ReleaseRecursive(tag string) error {
+	return d.release(tag, true)
+}
+
+// HoldSnapshots atomically adds holds given as map of full snapshot name to
+// tag. All snapshots have to be in the same pool. If cleanup is not nil holds
+// are temporary and released when cleanup is closed. Snapshots that don't
+// exist are ignored. On failure *BatchError is returned.
+func HoldSnapshots(holds map[string]string, cleanup *HoldCleanup) (err error) {
+	names := make([]string, 0, len(holds))
+	for name := range holds {
+		names = append(names, name)
+	}
+	if err = checkSamePool(names, "@", "snapshot"); err != nil {
+		return
+	}
+	cholds := C.fnvlist_alloc()
+	defer C.nvlist_free(cholds)
+	for name, tag := range holds {
+		csName := C.CString(name)
+		csTag := C.CString(tag)
+		C.fnvlist_add_string(cholds, csName, csTag)
+		C.free(unsafe.Pointer(csName))
+		C.free(unsafe.Pointer(csTag))
+	}
+	var errlist *C.nvlist_t
+	if rc := C.lzc_hold(cholds, cleanup.fd(), &errlist); rc != 0 {
+		err = lzcBatchError(errlist, syscall.Errno(rc), "cannot hold snapshot")
+	}
+	return
+}
+
+// ReleaseSnapshots atomically removes holds given as map of full snapshot
+// name to list of tags. All snapshots have to be in the same pool. On failure
+// *BatchError is returned.
+func ReleaseSnapshots(holds map[string][]string) (err error) {
+	names := make([]string, 0, len(holds))
+	for name := range holds {
+		names = append(names, name)
+	}
+	if err = checkSamePool(names, "@", "snapshot"); err != nil {
+		return
+	}
+	cholds := C.fnvlist_alloc()
+	defer C.nvlist_free(cholds)
+	for name, tags := range holds {
+		ctags := C.fnvlist_alloc()
+		for _, tag := range tags {
+			csTag := C.CString(tag)
+			C.fnvlist_add_boolean(ctags, csTag)
+			C.free(unsafe.Pointer(csTag))
+		}
+		csName := C.CString(name)
+		C.fnvlist_add_nvlist(cholds, csName, ctags)
+		C.free(unsafe.Pointer(csName))
+		C.nvlist_free(ctags)
+	}
+	var errlist *C.nvlist_t
+	if rc := C.lzc_release(cholds, &errlist); rc != 0 {
+		err = lzcBatchError(errlist, syscall.Errno(rc), "cannot release snapshot")
+	}
+	return
+}
+
+// HoldsRecursive - Lists user references of all snapshots of filesystem or
+// volume and of its descendants as map of full snapshot name to tags.
+// Snapshots without holds are not included.
+func (d *Dataset) HoldsRecursive() (holds map[string][]HoldTag, err error) {
+	var path string
+	if path, err = d.Path(); err != nil {
+		return
+	}
+	if d.Type != DatasetTypeFilesystem && d.Type != DatasetTypeVolume {
+		err = NewError(EBadtype, fmt.Sprintf("'%s' is not a filesystem or volume", path))
+		return
+	}
+	cholds := C.fnvlist_alloc()
+	defer C.nvlist_free(cholds)
+	if C.dataset_holds_gather(d.list, C.B_TRUE, cholds) != 0 {
+		err = LastError()
+		return
+	}
+	holds = make(map[string][]HoldTag)
+	for nvp := C.nvlist_next_nvpair(cholds, nil); nvp != nil; nvp = C.nvlist_next_nvpair(cholds, nvp) {
+		var tags *C.nvlist_t
+		if C.nvpair_value_nvlist(nvp, &tags) != 0 {
+			continue
+		}
+		holds[C.GoString(C.nvpair_name(nvp))] = holdTags(tags)
+	}
+	return
+}
+
+// holdTags - convert nvlist of tag -> timestamp to list of HoldTag
+func holdTags(nvl *C.nvlist_t) (tags []HoldTag) {
+	var tu64 C.uint64_t
+	tags = make([]HoldTag, 0, 5)
+	for nvp := C.nvlist_next_nvpair(nvl, nil); nvp != nil; nvp = C.nvlist_next_nvpair(nvl, nvp) {
+		C.nvpair_value_uint64(nvp, &tu64)
+		tags = append(tags, HoldTag{
+			Name:      C.GoString(C.nvpair_name(nvp)),
+			Timestamp: time.Unix(int64(tu64), 0),
+		})
+	}
+	return
+}
@@ -0,0 +1,251 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "common.h"
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"unsafe"
+)
+
+// toNvlist - convert Go map to newly allocated nvlist, caller has to free it.
+// Supported values are nil (boolean flag), bool, signed and unsigned
+// integers, string, []string, []int64, []uint64, []bool, nested
+// map[string]interface{} and []map[string]interface{}. Integers are stored
+// as int64 and int64 arrays since channel programs accept no other integer
+// types, unsigned values above math.MaxInt64 are rejected.
+func toNvlist(m map[string]interface{}) (nvl *C.nvlist_t, err error) {
+	nvl = C.fnvlist_alloc()
+	// sorted to get deterministic nvlist
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err = nvlistAdd(nvl, k, m[k]); err != nil {
+			C.nvlist_free(nvl)
+			nvl = nil
+			return
+		}
+	}
+	return
+}
+
+func nvlistAdd(nvl *C.nvlist_t, name string, value interface{}) (err error) {
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	switch v := value.(type) {
+	case nil:
+		C.fnvlist_add_boolean(nvl, csName)
+	case bool:
+		C.fnvlist_add_boolean_value(nvl, csName, booleanT(v))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		var n int64
+		if n, err = nvlistInt64(name, v); err != nil {
+			return
+		}
+		C.fnvlist_add_int64(nvl, csName, C.int64_t(n))
+	case string:
+		csValue := C.CString(v)
+		C.fnvlist_add_string(nvl, csName, csValue)
+		C.free(unsafe.Pointer(csValue))
+	case []string:
+		cvalues := C.alloc_cstrings(C.int(len(v)))
+		defer C.free(unsafe.Pointer(cvalues))
+		for i, s := range v {
+			csValue := C.CString(s)
+			defer C.free(unsafe.Pointer(csValue))
+			C.strings_setat(cvalues, C.int(i), csValue)
+		}
+		C.fnvlist_add_string_array(nvl, csName, cvalues, C.uint_t(len(v)))
+	case []bool:
+		cvalues := make([]C.boolean_t, len(v)+1)
+		for i, b := range v {
+			cvalues[i] = booleanT(b)
+		}
+		C.fnvlist_add_boolean_array(nvl, csName, &cvalues[0], C.uint_t(len(v)))
+	case []int64:
+		cvalues := make([]C.int64_t, len(v)+1)
+		for i, n := range v {
+			cvalues[i] = C.int64_t(n)
+		}
+		C.fnvlist_add_int64_array(nvl, csName, &cvalues[0], C.uint_t(len(v)))
+	case []uint64:
+		cvalues := make([]C.int64_t, len(v)+1)
+		for i, u := range v {
+			var n int64
+			if n, err = nvlistInt64(name, u); err != nil {
+				return
+			}
+			cvalues[i] = C.int64_t(n)
+		}
+		C.fnvlist_add_int64_array(nvl, csName, &cvalues[0], C.uint_t(len(v)))
+	case map[string]interface{}:
+		var child *C.nvlist_t
+		if child, err = toNvlist(v); err != nil {
+			return
+		}
+		C.fnvlist_add_nvlist(nvl, csName, child)
+		C.nvlist_free(child)
+	case []map[string]interface{}:
+		children := make([]*C.nvlist_t, len(v)+1)
+		defer func() {
+			for _, child := range children {
+				if child != nil {
+					C.nvlist_free(child)
+				}
+			}
+		}()
+		for i, m := range v {
+			if children[i], err = toNvlist(m); err != nil {
+				return
+			}
+		}
+		C.fnvlist_add_nvlist_array(nvl, csName, &children[0], C.uint_t(len(v)))
+	default:
+		err = NewError(EBadprop, fmt.Sprintf("unsupported nvlist value type %T of '%s'", value, name))
+	}
+	return
+}
+
+// nvlistInt64 - integer value as int64, the only integer type channel
+// programs accept
+func nvlistInt64(name string, value interface{}) (n int64, err error) {
+	switch v := value.(type) {
+	case int:
+		n = int64(v)
+	case int8:
+		n = int64(v)
+	case int16:
+		n = int64(v)
+	case int32:
+		n = int64(v)
+	case int64:
+		n = v
+	case uint:
+		return nvlistUint64(name, uint64(v))
+	case uint8:
+		n = int64(v)
+	case uint16:
+		n = int64(v)
+	case uint32:
+		n = int64(v)
+	case uint64:
+		return nvlistUint64(name, v)
+	}
+	return
+}
+
+func nvlistUint64(name string, v uint64) (n int64, err error) {
+	if v > math.MaxInt64 {
+		err = NewError(EBadprop, fmt.Sprintf("value %d of '%s' overflows int64", v, name))
+		return
+	}
+	return int64(v), nil
+}
+
+// fromNvlist - convert nvlist to Go map. Integers are converted to int64 and
+// uint64, boolean flags to true, nested nvlists to map[string]interface{}.
+func fromNvlist(nvl *C.nvlist_t) (m map[string]interface{}) {
+	m = make(map[string]interface{})
+	if nvl == nil {
+		return
+	}
+	for nvp := C.nvlist_next_nvpair(nvl, nil); nvp != nil; nvp = C.nvlist_next_nvpair(nvl, nvp) {
+		if value, ok := nvpairValue(nvp); ok {
+			m[C.GoString(C.nvpair_name(nvp))] = value
+		}
+	}
+	return
+}
+
+func nvpairValue(nvp *C.nvpair_t) (value interface{}, ok bool) {
+	ok = true
+	switch C.nvpair_type(nvp) {
+	case C.DATA_TYPE_BOOLEAN:
+		value = true
+	case C.DATA_TYPE_BOOLEAN_VALUE:
+		value = C.fnvpair_value_boolean_value(nvp) != 0
+	case C.DATA_TYPE_INT8:
+		value = int64(C.fnvpair_value_int8(nvp))
+	case C.DATA_TYPE_INT16:
+		value = int64(C.fnvpair_value_int16(nvp))
+	case C.DATA_TYPE_INT32:
+		value = int64(C.fnvpair_value_int32(nvp))
+	case C.DATA_TYPE_INT64:
+		value = int64(C.fnvpair_value_int64(nvp))
+	case C.DATA_TYPE_UINT8:
+		value = uint64(C.fnvpair_value_uint8(nvp))
+	case C.DATA_TYPE_UINT16:
+		value = uint64(C.fnvpair_value_uint16(nvp))
+	case C.DATA_TYPE_UINT32:
+		value = uint64(C.fnvpair_value_uint32(nvp))
+	case C.DATA_TYPE_UINT64:
+		value = uint64(C.fnvpair_value_uint64(nvp))
+	case C.DATA_TYPE_STRING:
+		value = C.GoString(C.fnvpair_value_string(nvp))
+	case C.DATA_TYPE_NVLIST:
+		value = fromNvlist(C.fnvpair_value_nvlist(nvp))
+	case C.DATA_TYPE_STRING_ARRAY:
+		var cvalues **C.char
+		var n C.uint_t
+		C.nvpair_value_string_array(nvp, &cvalues, &n)
+		values := make([]string, 0, n)
+		for _, cs := range (*[1 << 28]*C.char)(unsafe.Pointer(cvalues))[:n:n] {
+			values = append(values, C.GoString(cs))
+		}
+		value = values
+	case C.DATA_TYPE_BOOLEAN_ARRAY:
+		var cvalues *C.boolean_t
+		var n C.uint_t
+		C.nvpair_value_boolean_array(nvp, &cvalues, &n)
+		values := make([]bool, 0, n)
+		for _, b := range (*[1 << 28]C.boolean_t)(unsafe.Pointer(cvalues))[:n:n] {
+			values = append(values, b != 0)
+		}
+		value = values
+	case C.DATA_TYPE_INT64_ARRAY:
+		var cvalues *C.int64_t
+		var n C.uint_t
+		C.nvpair_value_int64_array(nvp, &cvalues, &n)
+		values := make([]int64, 0, n)
+		for _, i := range (*[1 << 28]C.int64_t)(unsafe.Pointer(cvalues))[:n:n] {
+			values = append(values, int64(i))
+		}
+		value = values
+	case C.DATA_TYPE_UINT64_ARRAY:
+		var cvalues *C.uint64_t
+		var n C.uint_t
+		C.nvpair_value_uint64_array(nvp, &cvalues, &n)
+		values := make([]uint64, 0, n)
+		for _, i := range (*[1 << 28]C.uint64_t)(unsafe.Pointer(cvalues))[:n:n] {
+			values = append(values, uint64(i))
+		}
+		value = values
+	case C.DATA_TYPE_NVLIST_ARRAY:
+		var cvalues **C.nvlist_t
+		var n C.uint_t
+		C.nvpair_value_nvlist_array(nvp, &cvalues, &n)
+		values := make([]map[string]interface{}, 0, n)
+		for _, child := range (*[1 << 28]*C.nvlist_t)(unsafe.Pointer(cvalues))[:n:n] {
+			values = append(values, fromNvlist(child))
+		}
+		value = values
+	default:
+		ok = false
+	}
+	return
+}
+
+// freeNvlist - free nvlist allocated by toNvlist, for tests which can't use
+// cgo
+func freeNvlist(nvl *C.nvlist_t) {
+	C.nvlist_free(nvl)
+}
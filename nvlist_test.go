@@ -0,0 +1,49 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNvlistConversion(t *testing.T) {
+	in := map[string]interface{}{
+		"flag":    nil,
+		"bool":    true,
+		"int":     int64(-5),
+		"string":  "value",
+		"strings": []string{"a", "b"},
+		"ints":    []int64{1, -2},
+		"nested":  map[string]interface{}{"x": "y"},
+		"array":   []map[string]interface{}{{"a": int64(1)}, {"b": int64(2)}},
+	}
+	nvl, err := toNvlist(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := fromNvlist(nvl)
+	freeNvlist(nvl)
+	in["flag"] = true // boolean flag is converted back as true
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("nvlist conversion mismatch\n in: %v\nout: %v", in, out)
+	}
+	if _, err = toNvlist(map[string]interface{}{"bad": 1.5}); err == nil {
+		t.Error("expected error on unsupported type")
+	}
+	// channel programs accept int64 as the only integer type
+	if nvl, err = toNvlist(map[string]interface{}{
+		"int8": int8(-1), "uint32": uint32(3), "uint": uint(4), "uints": []uint64{5, 6},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"int8": int64(-1), "uint32": int64(3), "uint": int64(4), "uints": []int64{5, 6},
+	}
+	out = fromNvlist(nvl)
+	freeNvlist(nvl)
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("integers not converted to int64: %v", out)
+	}
+	if _, err = toNvlist(map[string]interface{}{"big": uint64(1) << 63}); err == nil {
+		t.Error("expected error on int64 overflow")
+	}
+}
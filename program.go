@@ -0,0 +1,86 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "common.h"
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Channel program limits, same as used by zfs program
+const (
+	ProgramDefaultInstrLimit uint64 = 10 * 1000 * 1000
+	ProgramMaxInstrLimit            = 10 * ProgramDefaultInstrLimit
+	ProgramDefaultMemLimit   uint64 = 10 * 1024 * 1024
+	ProgramMaxMemLimit              = 10 * ProgramDefaultMemLimit
+)
+
+// ProgramOptions - zfs program options
+type ProgramOptions struct {
+	InstrLimit uint64 // -t, ProgramDefaultInstrLimit if 0
+	MemLimit   uint64 // -m, ProgramDefaultMemLimit if 0
+	NoSync     bool   // -n, run read-only without syncing txg
+}
+
+// RunChannelProgram runs ZFS Lua channel program script atomically in pool
+// syncing context. Args are passed to program as its argument table, see
+// toNvlist for supported value types. Returned map holds values returned by
+// program under "return" key. If program fails Lua error message is part of
+// returned error.
+func RunChannelProgram(pool string, script []byte, args map[string]interface{},
+	opts ProgramOptions) (result map[string]interface{}, err error) {
+	if opts.InstrLimit == 0 {
+		opts.InstrLimit = ProgramDefaultInstrLimit
+	}
+	if opts.MemLimit == 0 {
+		opts.MemLimit = ProgramDefaultMemLimit
+	}
+	if opts.InstrLimit > ProgramMaxInstrLimit || opts.MemLimit > ProgramMaxMemLimit {
+		err = NewError(EBadprop, fmt.Sprintf("program limits have to be at most %d instructions and %d bytes",
+			ProgramMaxInstrLimit, ProgramMaxMemLimit))
+		return
+	}
+	var cargs *C.nvlist_t
+	if cargs, err = toNvlist(args); err != nil {
+		return
+	}
+	defer C.nvlist_free(cargs)
+	csPool := C.CString(pool)
+	defer C.free(unsafe.Pointer(csPool))
+	csScript := C.CString(string(script))
+	defer C.free(unsafe.Pointer(csScript))
+
+	var outnvl *C.nvlist_t
+	rc := C.channel_program(csPool, csScript, C.uint64_t(opts.InstrLimit),
+		C.uint64_t(opts.MemLimit), booleanT(opts.NoSync), cargs, &outnvl)
+	result = fromNvlist(outnvl)
+	if outnvl != nil {
+		C.nvlist_free(outnvl)
+	}
+	if rc != 0 {
+		err = programError(syscall.Errno(rc), pool, result)
+	}
+	return
+}
+
+func programError(errno syscall.Errno, pool string, result map[string]interface{}) error {
+	msg := fmt.Sprintf("channel program failed on pool '%s'", pool)
+	switch errno {
+	case syscall.ETIME:
+		msg += ": instruction limit reached"
+	case syscall.ENOSPC:
+		msg += ": memory limit reached"
+	case syscall.ENOTSUP:
+		msg += ": channel programs are not supported"
+	}
+	if lerr, ok := result["error"].(string); ok {
+		msg += ": " + lerr
+	}
+	return errnoError(errno, msg)
+}
@@ -0,0 +1,133 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "common.h"
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"fmt"
+	"time"
+)
+
+// PropertySource - source of property value (zprop_source_t)
+type PropertySource int
+
+// Property value sources
+const (
+	PropertySourceNone      PropertySource = C.ZPROP_SRC_NONE
+	PropertySourceDefault   PropertySource = C.ZPROP_SRC_DEFAULT
+	PropertySourceTemporary PropertySource = C.ZPROP_SRC_TEMPORARY
+	PropertySourceLocal     PropertySource = C.ZPROP_SRC_LOCAL
+	PropertySourceInherited PropertySource = C.ZPROP_SRC_INHERITED
+	PropertySourceReceived  PropertySource = C.ZPROP_SRC_RECEIVED
+)
+
+func (s PropertySource) String() string {
+	switch s {
+	case PropertySourceNone:
+		return "none"
+	case PropertySourceDefault:
+		return "default"
+	case PropertySourceTemporary:
+		return "temporary"
+	case PropertySourceLocal:
+		return "local"
+	case PropertySourceInherited:
+		return "inherited"
+	case PropertySourceReceived:
+		return "received"
+	}
+	return "unknown"
+}
+
+// propertyValue - convert property read by libzfs wrappers to PropertyValue
+func propertyValue(plist *C.property_list_t) PropertyValue {
+	return PropertyValue{
+		Value:      C.GoString(&(*plist).value[0]),
+		Source:     C.GoString(&(*plist).source[0]),
+		Numeric:    uint64(plist.numeric),
+		IsNumeric:  plist.numeric_valid != 0,
+		SourceType: PropertySource(plist.source_type),
+	}
+}
+
+// getNumeric reload property and check that it has numeric value
+func (d *Dataset) getNumeric(p DatasetProp) (prop PropertyValue, err error) {
+	if prop, err = d.GetProperty(p); err != nil {
+		return
+	}
+	if !prop.IsNumeric {
+		err = NewError(EProptype, fmt.Sprintf("'%s' is not a numeric property",
+			DatasetPropertyToName(p)))
+	}
+	return
+}
+
+// GetUint64 reload and return raw numeric value of number or index property
+// e.g. used, available, quota in bytes
+func (d *Dataset) GetUint64(p DatasetProp) (value uint64, err error) {
+	var prop PropertyValue
+	if prop, err = d.getNumeric(p); err != nil {
+		return
+	}
+	value = prop.Numeric
+	return
+}
+
+// GetBool reload and return value of on/off or yes/no property
+func (d *Dataset) GetBool(p DatasetProp) (value bool, err error) {
+	var prop PropertyValue
+	if prop, err = d.getNumeric(p); err != nil {
+		return
+	}
+	switch prop.Value {
+	case "on", "yes":
+		value = true
+	case "off", "no":
+		value = false
+	default:
+		err = NewError(EProptype, fmt.Sprintf("'%s' is not a boolean property (%s)",
+			DatasetPropertyToName(p), prop.Value))
+	}
+	return
+}
+
+// GetTime reload and return value of time property e.g. creation
+func (d *Dataset) GetTime(p DatasetProp) (value time.Time, err error) {
+	var prop PropertyValue
+	if prop, err = d.getNumeric(p); err != nil {
+		return
+	}
+	value = time.Unix(int64(prop.Numeric), 0)
+	return
+}
+
+// GetRatio reload and return value of ratio property e.g. compressratio,
+// refratio. libzfs keep ratios as hundredths.
+func (d *Dataset) GetRatio(p DatasetProp) (value float64, err error) {
+	var prop PropertyValue
+	if prop, err = d.getNumeric(p); err != nil {
+		return
+	}
+	value = float64(prop.Numeric) / 100
+	return
+}
+
+// GetEnum reload and return index and its name of index property
+// e.g. compression, sync, canmount
+func (d *Dataset) GetEnum(p DatasetProp) (index uint64, name string, err error) {
+	var prop PropertyValue
+	if prop, err = d.getNumeric(p); err != nil {
+		return
+	}
+	if C.zfs_prop_get_type(C.zfs_prop_t(p)) != C.PROP_TYPE_INDEX {
+		err = NewError(EProptype, fmt.Sprintf("'%s' is not an index property",
+			DatasetPropertyToName(p)))
+		return
+	}
+	index, name = prop.Numeric, prop.Value
+	return
+}
@@ -0,0 +1,58 @@
+package zfs
+
+import (
+	"testing"
+)
+
+func TestDatasetTypedProperties(t *testing.T) {
+	d, err := DatasetOpenSingle(*testPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	t.Run("uint64", func(t *testing.T) {
+		used, err := d.GetUint64(DatasetPropUsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used == 0 {
+			t.Error("used have to be non zero")
+		}
+		t.Log("used:", used, "source:", d.Properties[DatasetPropUsed].SourceType)
+	})
+	t.Run("bool", func(t *testing.T) {
+		atime, err := d.GetBool(DatasetPropAtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log("atime:", atime)
+	})
+	t.Run("time", func(t *testing.T) {
+		creation, err := d.GetTime(DatasetPropCreation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log("creation:", creation)
+	})
+	t.Run("ratio", func(t *testing.T) {
+		ratio, err := d.GetRatio(DatasetPropCompressratio)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ratio < 1 {
+			t.Errorf("wrong compressratio %f", ratio)
+		}
+	})
+	t.Run("enum", func(t *testing.T) {
+		index, name, err := d.GetEnum(DatasetPropCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log("compression:", index, name)
+	})
+	t.Run("string property is not numeric", func(t *testing.T) {
+		if _, err := d.GetUint64(DatasetPropMountpoint); err == nil {
+			t.Error("have to return an error")
+		}
+	})
+}
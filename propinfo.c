@@ -0,0 +1,28 @@
+#include <libzfs.h>
+#include <zfs_prop.h>
+#include <memory.h>
+#include <string.h>
+#include <stdio.h>
+#include "common.h"
+#include "propinfo.h"
+
+zprop_desc_ptr dataset_prop_desc(int prop) {
+	if (prop < 0 || prop >= ZFS_NUM_PROPS) {
+		return NULL;
+	}
+	return &zfs_prop_get_table()[prop];
+}
+
+zprop_desc_ptr pool_prop_desc(int prop) {
+	if (prop < 0 || prop >= ZPOOL_NUM_PROPS) {
+		return NULL;
+	}
+	return &zpool_prop_get_table()[prop];
+}
+
+zprop_index_ptr prop_desc_index_at(zprop_desc_ptr pd, int i) {
+	if (pd == NULL || pd->pd_table == NULL || i < 0 || i >= pd->pd_table_size) {
+		return NULL;
+	}
+	return &pd->pd_table[i];
+}
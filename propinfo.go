@@ -0,0 +1,185 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "common.h"
+// #include "zpool.h"
+// #include "zfs.h"
+// #include "propinfo.h"
+import "C"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// PropType - type of property value
+type PropType int
+
+// Property value types
+const (
+	PropTypeNumber PropType = C.PROP_TYPE_NUMBER // numeric value
+	PropTypeString PropType = C.PROP_TYPE_STRING // string value
+	PropTypeIndex  PropType = C.PROP_TYPE_INDEX  // one of fixed set of values
+)
+
+func (t PropType) String() string {
+	switch t {
+	case PropTypeNumber:
+		return "number"
+	case PropTypeString:
+		return "string"
+	case PropTypeIndex:
+		return "index"
+	}
+	return "unknown"
+}
+
+// PropIndex - one of valid values of index property
+type PropIndex struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// PropInfo - property metadata
+type PropInfo struct {
+	Name        string        `json:"name"`
+	Type        PropType      `json:"type"`
+	ReadOnly    bool          `json:"readonly"`
+	Inheritable bool          `json:"inheritable"`
+	CreateOnly  bool          `json:"create_only"` // can be set only at create (or import) time
+	Visible     bool          `json:"visible"`
+	Types       []DatasetType `json:"types,omitempty"` // dataset types property applies to
+	Values      string        `json:"values,omitempty"` // description of valid values
+	Index       []PropIndex   `json:"index,omitempty"`  // valid values of index property
+	Default     string        `json:"default,omitempty"`
+}
+
+// numberPropsAcceptNone - numeric properties with "none" as valid value
+var numberPropsAcceptNone = map[DatasetProp]bool{
+	DatasetPropQuota:           true,
+	DatasetPropRefquota:        true,
+	DatasetPropReservation:     true,
+	DatasetPropRefreservation:  true,
+	DatasetPropFilesystemLimit: true,
+	DatasetPropSnapshotLimit:   true,
+}
+
+func propInfo(pd C.zprop_desc_ptr) (info PropInfo) {
+	info.Name = C.GoString(pd.pd_name)
+	info.Type = PropType(pd.pd_proptype)
+	info.Visible = pd.pd_visible != 0
+	if pd.pd_values != nil {
+		info.Values = C.GoString(pd.pd_values)
+	}
+	for i := 0; ; i++ {
+		idx := C.prop_desc_index_at(pd, C.int(i))
+		if idx == nil || idx.pi_name == nil {
+			break
+		}
+		info.Index = append(info.Index, PropIndex{
+			Name:  C.GoString(idx.pi_name),
+			Value: uint64(idx.pi_value),
+		})
+	}
+	switch info.Type {
+	case PropTypeString:
+		if pd.pd_strdefault != nil {
+			info.Default = C.GoString(pd.pd_strdefault)
+		}
+	case PropTypeIndex:
+		for _, idx := range info.Index {
+			if idx.Value == uint64(pd.pd_numdefault) {
+				info.Default = idx.Name
+				break
+			}
+		}
+	default:
+		info.Default = strconv.FormatUint(uint64(pd.pd_numdefault), 10)
+	}
+	return
+}
+
+// DatasetPropInfo returns metadata of dataset property
+func DatasetPropInfo(p DatasetProp) (info PropInfo, err error) {
+	pd := C.dataset_prop_desc(C.int(p))
+	if p >= zfsMaxDatasetProp || pd == nil || pd.pd_name == nil {
+		err = NewError(EBadprop, fmt.Sprintf("invalid dataset property %d", int(p)))
+		return
+	}
+	info = propInfo(pd)
+	cp := C.zfs_prop_t(p)
+	info.Inheritable = C.zfs_prop_inheritable(cp) != 0
+	info.CreateOnly = C.zfs_prop_setonce(cp) != 0
+	// libzfs reports set once properties as readonly too
+	info.ReadOnly = C.zfs_prop_readonly(cp) != 0 && !info.CreateOnly
+	for _, t := range []DatasetType{DatasetTypeFilesystem, DatasetTypeSnapshot,
+		DatasetTypeVolume, DatasetTypeBookmark} {
+		if C.zfs_prop_valid_for_type(cp, C.zfs_type_t(t), C.B_FALSE) != 0 {
+			info.Types = append(info.Types, t)
+		}
+	}
+	return
+}
+
+// PoolPropInfo returns metadata of pool property
+func PoolPropInfo(p PoolProp) (info PropInfo, err error) {
+	pd := C.pool_prop_desc(C.int(p))
+	if p >= zfsMaxPoolProp || pd == nil || pd.pd_name == nil {
+		err = NewError(EBadprop, fmt.Sprintf("invalid pool property %d", int(p)))
+		return
+	}
+	info = propInfo(pd)
+	cp := C.zpool_prop_t(p)
+	info.CreateOnly = C.zpool_prop_setonce(cp) != 0
+	info.ReadOnly = C.zpool_prop_readonly(cp) != 0 && !info.CreateOnly
+	return
+}
+
+// ValidateProperty checks if value is valid for property of dataset of type
+// dtype before passing it to libzfs. Checks done by libzfs against current
+// state of dataset (e.g. quota less than used space) are not performed.
+func ValidateProperty(p DatasetProp, value string, dtype DatasetType) (err error) {
+	var info PropInfo
+	if info, err = DatasetPropInfo(p); err != nil {
+		return
+	}
+	cp := C.zfs_prop_t(p)
+	if C.zfs_prop_valid_for_type(cp, C.zfs_type_t(dtype), C.B_FALSE) == 0 {
+		return NewError(EProptype, fmt.Sprintf("'%s' does not apply to datasets of type %s",
+			info.Name, dtype.String()))
+	}
+	if info.ReadOnly {
+		return NewError(EPropreadonly, fmt.Sprintf("'%s' is readonly", info.Name))
+	}
+	if len(value) >= C.ZFS_MAXPROPLEN {
+		return NewError(EBadprop, fmt.Sprintf("'%s' is too long", info.Name))
+	}
+	csValue := C.CString(value)
+	defer C.free(unsafe.Pointer(csValue))
+	switch info.Type {
+	case PropTypeIndex:
+		var index C.uint64_t
+		if C.zfs_prop_string_to_index(cp, csValue, &index) != 0 {
+			return NewError(EBadprop, fmt.Sprintf("'%s' must be one of '%s'",
+				info.Name, info.Values))
+		}
+	case PropTypeNumber:
+		if value == "none" && numberPropsAcceptNone[p] {
+			return
+		}
+		var num C.uint64_t
+		if C.zfs_nicestrtonum(nil, csValue, &num) != 0 {
+			return NewError(EBadprop, fmt.Sprintf("'%s' must be a number", info.Name))
+		}
+	case PropTypeString:
+		if p == DatasetPropMountpoint && value != "none" && value != "legacy" &&
+			!strings.HasPrefix(value, "/") {
+			return NewError(EBadpath, fmt.Sprintf("'%s' must be an absolute path, 'none', or 'legacy'",
+				info.Name))
+		}
+	}
+	return
+}
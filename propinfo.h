@@ -0,0 +1,13 @@
+#ifndef __PROPINFO_H__
+#define __PROPINFO_H__
+
+#include <zfs_prop.h>
+
+typedef zprop_desc_t* zprop_desc_ptr;
+typedef const zprop_index_t* zprop_index_ptr;
+
+zprop_desc_ptr dataset_prop_desc(int prop);
+zprop_desc_ptr pool_prop_desc(int prop);
+zprop_index_ptr prop_desc_index_at(zprop_desc_ptr pd, int i);
+
+#endif //__PROPINFO_H__
@@ -0,0 +1,64 @@
+package zfs
+
+import (
+	"testing"
+)
+
+func TestDatasetPropInfo(t *testing.T) {
+	t.Run("index property", func(t *testing.T) {
+		info, err := DatasetPropInfo(DatasetPropCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Type != PropTypeIndex || len(info.Index) == 0 || !info.Inheritable {
+			t.Errorf("wrong compression info %+v", info)
+		}
+		t.Log(info)
+	})
+	t.Run("readonly property", func(t *testing.T) {
+		info, err := DatasetPropInfo(DatasetPropUsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Type != PropTypeNumber || !info.ReadOnly {
+			t.Errorf("wrong used info %+v", info)
+		}
+	})
+	t.Run("create only property", func(t *testing.T) {
+		info, err := DatasetPropInfo(DatasetPropVolblocksize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.CreateOnly || info.ReadOnly || len(info.Types) != 1 || info.Types[0] != DatasetTypeVolume {
+			t.Errorf("wrong volblocksize info %+v", info)
+		}
+	})
+	t.Run("pool property", func(t *testing.T) {
+		info, err := PoolPropInfo(PoolPropAshift)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(info)
+	})
+}
+
+func TestValidateProperty(t *testing.T) {
+	if err := ValidateProperty(DatasetPropCompression, "lz4", DatasetTypeFilesystem); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateProperty(DatasetPropCompression, "bogus", DatasetTypeFilesystem); err == nil {
+		t.Error("invalid compression have to be rejected")
+	}
+	if err := ValidateProperty(DatasetPropQuota, "10G", DatasetTypeFilesystem); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateProperty(DatasetPropQuota, "none", DatasetTypeFilesystem); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateProperty(DatasetPropVolsize, "1G", DatasetTypeFilesystem); err == nil {
+		t.Error("volsize have to be rejected for filesystem")
+	}
+	if err := ValidateProperty(DatasetPropUsed, "1G", DatasetTypeFilesystem); err == nil {
+		t.Error("used have to be rejected as readonly")
+	}
+}
@@ -0,0 +1,161 @@
+package zfs
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hainguyen8y/go-libzfs/sendstream"
+)
+
+// RecvResult - what receive created
+type RecvResult struct {
+	// Dataset is received filesystem or volume, top one of replicated stream
+	Dataset string `json:"dataset"`
+	// Snapshots received, per filesystem oldest first
+	Snapshots []string `json:"snapshots"`
+	// FromGUID is guid of incremental source snapshot, 0 for full stream
+	FromGUID uint64 `json:"fromguid"`
+	// BytesRead from input by the time receive finished
+	BytesRead uint64 `json:"bytes_read"`
+	// Resumable is set if receive was interrupted and left partial state
+	// which can be resumed by sending with ResumeToken
+	Resumable   bool   `json:"resumable"`
+	ResumeToken string `json:"resume_token,omitempty"`
+	// EncryptionRoot of received dataset, empty if it is not encrypted
+	EncryptionRoot string `json:"encryption_root,omitempty"`
+}
+
+// countingReader - counts bytes read, read concurrently by pipe goroutine
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	atomic.AddUint64(&cr.n, uint64(n))
+	return
+}
+
+func (cr *countingReader) count() uint64 {
+	return atomic.LoadUint64(&cr.n)
+}
+
+// peekStreamBegin - read stream up to BEGIN record of its first snapshot
+// stream, skipping compound header of replication stream. Returns the
+// record, nil if it was not found, and all bytes read from r.
+func peekStreamBegin(r io.Reader) (begin *sendstream.Begin, peeked []byte) {
+	var buf bytes.Buffer
+	reader := sendstream.NewReader(io.TeeReader(r, &buf))
+	for {
+		rec, err := reader.Next()
+		if err != nil {
+			// errors are left to libzfs reading incomplete stream
+			break
+		}
+		if rec.Type == sendstream.RecordBegin && rec.Begin.HeaderType != sendstream.HeaderCompound {
+			begin = rec.Begin
+			break
+		}
+	}
+	return begin, buf.Bytes()
+}
+
+// recvTarget - name of filesystem or volume stream with snapshot toname is
+// received to, following zfs receive -d and -e rules
+func recvTarget(dest, toname string, flags *RecvFlags) string {
+	if i := strings.Index(dest, "@"); i >= 0 {
+		dest = dest[:i]
+	}
+	if i := strings.Index(toname, "@"); i >= 0 {
+		toname = toname[:i]
+	}
+	switch {
+	case flags.IsTail:
+		return dest + "/" + path.Base(toname)
+	case flags.IsPrefix:
+		if i := strings.Index(toname, "/"); i >= 0 {
+			return dest + toname[i:]
+		}
+		return dest
+	}
+	return dest
+}
+
+// snapshotGUIDs - guids of all snapshots of dataset name and its descendants,
+// missing dataset has none
+func snapshotGUIDs(name string) (guids map[string]string) {
+	guids = make(map[string]string)
+	d, err := DatasetOpen(name)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	var walk func(ds *Dataset)
+	walk = func(ds *Dataset) {
+		for i := range ds.Children {
+			ch := &ds.Children[i]
+			if ch.IsSnapshot() {
+				guids[ch.Properties[DatasetPropGUID].Value] = ch.Properties[DatasetPropName].Value
+			} else {
+				walk(ch)
+			}
+		}
+	}
+	walk(&d)
+	return
+}
+
+// receivedSnapshots - snapshots of target tree not listed in before,
+// per filesystem oldest first
+func receivedSnapshots(target string, before map[string]string) (snaps []string) {
+	d, err := DatasetOpen(target)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	var walk func(ds *Dataset)
+	walk = func(ds *Dataset) {
+		var fsSnaps []Dataset
+		for i := range ds.Children {
+			if ds.Children[i].IsSnapshot() {
+				fsSnaps = append(fsSnaps, ds.Children[i])
+			}
+		}
+		sort.Sort(snapshotsCreateAsc(fsSnaps))
+		for _, s := range fsSnaps {
+			if _, ok := before[s.Properties[DatasetPropGUID].Value]; !ok {
+				snaps = append(snaps, s.Properties[DatasetPropName].Value)
+			}
+		}
+		for i := range ds.Children {
+			if !ds.Children[i].IsSnapshot() {
+				walk(&ds.Children[i])
+			}
+		}
+	}
+	walk(&d)
+	return
+}
+
+// resumeState - resume token of interrupted receive into target
+func resumeState(target string) (token string, ok bool) {
+	prop, err := datasetProperty(target, DatasetPropReceiveResumeToken)
+	if err != nil || len(prop.Value) == 0 || prop.Value == "-" {
+		return
+	}
+	return prop.Value, true
+}
+
+// encryptionRoot - encryption root of dataset name, empty if not encrypted
+func encryptionRoot(name string) (root string) {
+	prop, err := datasetProperty(name, DatasetPropEncryptionRoot)
+	if err != nil || prop.Value == "-" {
+		return
+	}
+	return prop.Value
+}
@@ -0,0 +1,102 @@
+package zfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// testRecord - dmu_replay_record_t of type typ with union filled by fill
+func testRecord(typ uint32, fill func(u []byte)) []byte {
+	h := make([]byte, 312)
+	binary.LittleEndian.PutUint32(h, typ)
+	fill(h[8:])
+	return h
+}
+
+func testBegin(hdrtype, objset uint32, toname string, fromguid, toguid uint64) []byte {
+	return testRecord(0, func(u []byte) {
+		binary.LittleEndian.PutUint64(u[0:], 0x2F5bacbac)
+		binary.LittleEndian.PutUint64(u[8:], uint64(hdrtype))
+		binary.LittleEndian.PutUint32(u[24:], objset)
+		binary.LittleEndian.PutUint64(u[32:], toguid)
+		binary.LittleEndian.PutUint64(u[40:], fromguid)
+		copy(u[48:], toname)
+	})
+}
+
+// testFletcher4 - fletcher-4 of little endian data, as END record carries it
+func testFletcher4(data []byte) (sum [4]uint64) {
+	for i := 0; i+4 <= len(data); i += 4 {
+		sum[0] += uint64(binary.LittleEndian.Uint32(data[i:]))
+		sum[1] += sum[0]
+		sum[2] += sum[1]
+		sum[3] += sum[2]
+	}
+	return
+}
+
+func TestPeekStreamBegin(t *testing.T) {
+	plain := testBegin(1, 3, "pool/vol@snap", 7, 8)
+	// compound header with nvlist payload, its END and first substream
+	header := testBegin(2, 2, "pool/fs@b", 0, 0)
+	binary.LittleEndian.PutUint32(header[4:], 16)
+	header = append(header, make([]byte, 16)...)
+	sum := testFletcher4(header)
+	compound := append(header, testRecord(5, func(u []byte) {
+		for i, v := range sum {
+			binary.LittleEndian.PutUint64(u[8*i:], v)
+		}
+	})...)
+	compound = append(compound, testBegin(1, 2, "pool/fs@a", 42, 43)...)
+
+	for _, tc := range []struct {
+		name, toname string
+		data         []byte
+		fromguid     uint64
+		objset       uint32
+	}{
+		{"plain", "pool/vol@snap", plain, 7, 3},
+		{"compound", "pool/fs@a", compound, 42, 2},
+	} {
+		data := append(append([]byte(nil), tc.data...), "payload"...)
+		src := bytes.NewReader(data)
+		begin, peeked := peekStreamBegin(src)
+		if begin == nil || begin.ToName != tc.toname || begin.FromGUID != tc.fromguid || begin.ObjsetType != tc.objset {
+			t.Errorf("%s: parsed %+v", tc.name, begin)
+			continue
+		}
+		if !bytes.Equal(peeked, tc.data) {
+			t.Errorf("%s: peeked %d bytes, expected %d", tc.name, len(peeked), len(tc.data))
+		}
+		all, err := ioutil.ReadAll(io.MultiReader(bytes.NewReader(peeked), src))
+		if err != nil || !bytes.Equal(all, data) {
+			t.Errorf("%s: stream not preserved: %v", tc.name, err)
+		}
+	}
+	if begin, peeked := peekStreamBegin(strings.NewReader("short")); begin != nil || string(peeked) != "short" {
+		t.Errorf("short stream parsed as %+v, peeked %q", begin, peeked)
+	}
+}
+
+func TestRecvTarget(t *testing.T) {
+	for _, tc := range []struct {
+		dest, toname string
+		flags        RecvFlags
+		expected     string
+	}{
+		{"backup/fs", "pool/a/b@s", RecvFlags{}, "backup/fs"},
+		{"backup/fs@s", "pool/a/b@s", RecvFlags{}, "backup/fs"},
+		{"backup", "pool/a/b@s", RecvFlags{IsPrefix: true}, "backup/a/b"},
+		{"backup", "pool@s", RecvFlags{IsPrefix: true}, "backup"},
+		{"backup", "pool/a/b@s", RecvFlags{IsTail: true}, "backup/b"},
+	} {
+		if target := recvTarget(tc.dest, tc.toname, &tc.flags); target != tc.expected {
+			t.Errorf("recvTarget(%q, %q, %+v) = %q, expected %q",
+				tc.dest, tc.toname, tc.flags, target, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package zfs
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultReplicateHoldTag - tag of temporary holds of base snapshots
+const DefaultReplicateHoldTag = "go-libzfs-replicate"
+
+// ReplicateOptions - options of Replicate
+type ReplicateOptions struct {
+	// SendFlags of sent streams (Compress, LargeBlock, EmbedData, Raw,
+	// Props, ...). Replicate, DoAll, FromOrigin, DryRun and Saved are
+	// ignored. Raw replica of encrypted source is its own encryption root
+	// if source is, otherwise it inherits encryption root of target parent
+	// when that is raw replica of source encryption root.
+	SendFlags
+	// Force rolls target back to the common snapshot, destroying target
+	// snapshots created after it (receive -F), and aborts partial receive
+	// state that cannot be resumed from source
+	Force bool
+	// Resumable leaves resumable state on target if transfer is interrupted
+	// (receive -s), next Replicate resumes it
+	Resumable bool
+	// Prune destroys target snapshots which do not exist on source
+	Prune bool
+	// NoMount does not mount received filesystem (receive -u)
+	NoMount bool
+	// HoldTag of temporary holds of base snapshots during transfer,
+	// DefaultReplicateHoldTag if empty
+	HoldTag string
+	// SetProps and ExcludeProps override received properties, see
+	// RecvOptions
+	SetProps     map[string]string
+	ExcludeProps []string
+	// OnProgress is called every ProgressInterval for each sent stream
+	OnProgress       func(SendProgress)
+	ProgressInterval time.Duration
+}
+
+// ReplicateResult - what Replicate did
+type ReplicateResult struct {
+	// Base is source snapshot or bookmark incremental send started from,
+	// empty if target was created by full stream
+	Base string `json:"base,omitempty"`
+	// Resumed is snapshot whose interrupted transfer was resumed
+	Resumed string `json:"resumed,omitempty"`
+	// Received snapshots of target, oldest first
+	Received []string `json:"received"`
+	// Pruned target snapshots
+	Pruned []string `json:"pruned,omitempty"`
+	// BytesSent in all streams
+	BytesSent uint64 `json:"bytes_sent"`
+}
+
+// replSnapshot - snapshot or bookmark of replicated filesystem
+type replSnapshot struct {
+	Name      string
+	GUID      uint64
+	CreateTXG uint64
+}
+
+// replStream - stream of replication plan, incremental from From (snapshot
+// or bookmark) to To, with intermediary snapshots if All is set
+type replStream struct {
+	From string
+	To   string
+	All  bool
+}
+
+// replPlan - streams bringing target up to date with source
+type replPlan struct {
+	Base       string // source snapshot or bookmark streams start from
+	BaseTarget string // target snapshot matching Base
+	Streams    []replStream
+}
+
+// planReplicate - find newest source snapshot, or bookmark if there is
+// none, with the same guid as one of target snapshots and plan streams of
+// all source snapshots after it. Snapshots and bookmarks are sorted oldest
+// first. Target without snapshots gets full stream of oldest source
+// snapshot first.
+func planReplicate(src, bookmarks, dst []replSnapshot) (plan replPlan, err error) {
+	if len(src) == 0 {
+		err = NewError(ENoent, "source has no snapshots to replicate")
+		return
+	}
+	dstGUIDs := make(map[uint64]string, len(dst))
+	for _, s := range dst {
+		dstGUIDs[s.GUID] = s.Name
+	}
+	next := 0
+	fromSnapshot := false
+	for i := len(src) - 1; i >= 0; i-- {
+		if name, ok := dstGUIDs[src[i].GUID]; ok {
+			plan.Base, plan.BaseTarget = src[i].Name, name
+			next, fromSnapshot = i+1, true
+			break
+		}
+	}
+	if len(plan.Base) == 0 {
+		for i := len(bookmarks) - 1; i >= 0; i-- {
+			if name, ok := dstGUIDs[bookmarks[i].GUID]; ok {
+				plan.Base, plan.BaseTarget = bookmarks[i].Name, name
+				next = sort.Search(len(src), func(j int) bool {
+					return src[j].CreateTXG > bookmarks[i].CreateTXG
+				})
+				break
+			}
+		}
+	}
+	if len(plan.Base) == 0 && len(dst) > 0 {
+		err = NewError(EExists, "source and target have no common snapshot or bookmark")
+		return
+	}
+	if next >= len(src) {
+		// up to date
+		return
+	}
+	last := src[len(src)-1].Name
+	if !fromSnapshot {
+		// full stream or single incremental from bookmark first
+		plan.Streams = append(plan.Streams, replStream{From: plan.Base, To: src[next].Name})
+		if next == len(src)-1 {
+			return
+		}
+		plan.Streams = append(plan.Streams, replStream{From: src[next].Name, To: last, All: true})
+		return
+	}
+	plan.Streams = append(plan.Streams, replStream{From: plan.Base, To: last, All: true})
+	return
+}
+
+// replPrune - target snapshots whose guid is not among source snapshots
+func replPrune(src, dst []replSnapshot) (names []string) {
+	srcGUIDs := make(map[uint64]bool, len(src))
+	for _, s := range src {
+		srcGUIDs[s.GUID] = true
+	}
+	for _, s := range dst {
+		if !srcGUIDs[s.GUID] {
+			names = append(names, s.Name)
+		}
+	}
+	return
+}
+
+// replSnapshots - snapshots of filesystem or volume name oldest first,
+// exists is false if there is no such dataset
+func replSnapshots(name string) (snaps []replSnapshot, exists bool, err error) {
+	var fs Dataset
+	if fs, err = DatasetOpenSingle(name); err != nil {
+		if e, ok := err.(*Error); ok && e.ErrorCode() == ENoent {
+			err = nil
+		}
+		return
+	}
+	defer fs.Close()
+	exists = true
+	var list []Dataset
+	if list, err = fs.openSnapshots(); err != nil {
+		return
+	}
+	defer DatasetCloseAll(list)
+	for i := range list {
+		s := replSnapshot{Name: list[i].Properties[DatasetPropName].Value}
+		s.GUID, _ = strconv.ParseUint(list[i].Properties[DatasetPropGUID].Value, 10, 64)
+		s.CreateTXG, _ = strconv.ParseUint(list[i].Properties[DatasetPropCreateTXG].Value, 10, 64)
+		snaps = append(snaps, s)
+	}
+	return
+}
+
+// replBookmarks - bookmarks of filesystem or volume name oldest first
+func replBookmarks(name string) (bookmarks []replSnapshot, err error) {
+	var fs Dataset
+	if fs, err = DatasetOpenSingle(name); err != nil {
+		return
+	}
+	defer fs.Close()
+	var list []Bookmark
+	if list, err = fs.Bookmarks(); err != nil {
+		return
+	}
+	for _, bm := range list {
+		bookmarks = append(bookmarks, replSnapshot{Name: bm.Name, GUID: bm.GUID, CreateTXG: bm.CreateTXG})
+	}
+	return
+}
+
+// replTransfer - receive into target stream written by send, both run
+// concurrently. Error of send is returned if it failed first, since
+// receive then fails only on truncated stream.
+func replTransfer(target string, opts *RecvOptions, send func(w io.Writer) error) (res RecvResult, err error) {
+	pr, pw := io.Pipe()
+	sendErr := make(chan error, 1)
+	go func() {
+		err := send(pw)
+		pw.CloseWithError(err)
+		sendErr <- err
+	}()
+	res, err = receive(target, pr, opts)
+	pr.CloseWithError(io.ErrClosedPipe) // stop send if receive gave up
+	if serr := <-sendErr; serr != nil && err == nil {
+		err = serr
+	}
+	return
+}
+
+// Replicate brings filesystem or volume target up to date with source. It
+// finds the newest source snapshot with the same guid as one of target
+// snapshots (or source bookmark if no such snapshot is left), and sends all
+// source snapshots created after it to target. Missing target is created by
+// full stream of the oldest source snapshot. Partial state of interrupted
+// resumable receive on target is resumed first. Base snapshots are held
+// during transfer, see ReplicateOptions for other options. Only source
+// itself is replicated, not its descendants.
+func Replicate(source, target string, opts ReplicateOptions) (res ReplicateResult, err error) {
+	if strings.ContainsAny(source, "@#") || strings.ContainsAny(target, "@#") {
+		err = NewError(EBadtype, "source and target of replication must be filesystems or volumes")
+		return
+	}
+	tag := opts.HoldTag
+	if len(tag) == 0 {
+		tag = DefaultReplicateHoldTag
+	}
+	sendOpts := SendOptions{
+		SendFlags:        opts.SendFlags,
+		OnProgress:       opts.OnProgress,
+		ProgressInterval: opts.ProgressInterval,
+	}
+	sendOpts.Replicate, sendOpts.DoAll, sendOpts.FromOrigin = false, false, false
+	sendOpts.DryRun, sendOpts.Saved = false, false
+	recvOpts := RecvOptions{
+		RecvFlags: RecvFlags{
+			Force:     opts.Force,
+			Resumable: opts.Resumable,
+			NoMount:   opts.NoMount,
+		},
+		SetProps:     opts.SetProps,
+		ExcludeProps: opts.ExcludeProps,
+	}
+	received := func(r RecvResult) {
+		res.Received = append(res.Received, r.Snapshots...)
+		res.BytesSent += r.BytesRead
+	}
+
+	var src, dst, bookmarks []replSnapshot
+	var exists bool
+	if src, exists, err = replSnapshots(source); err != nil {
+		return
+	}
+	if !exists {
+		err = NewError(ENoent, fmt.Sprintf("cannot open '%s': dataset does not exist", source))
+		return
+	}
+	if res.Resumed, err = replResume(target, src, &opts, sendOpts, recvOpts, received); err != nil {
+		return
+	}
+	if dst, exists, err = replSnapshots(target); err != nil {
+		return
+	}
+	if exists && len(dst) > 0 {
+		if bookmarks, err = replBookmarks(source); err != nil {
+			return
+		}
+	}
+	var plan replPlan
+	if plan, err = planReplicate(src, bookmarks, dst); err != nil {
+		return
+	}
+	res.Base = plan.Base
+	var cleanup *HoldCleanup
+	defer func() {
+		if cleanup != nil {
+			cleanup.Close()
+		}
+	}()
+	if len(plan.Streams) > 0 && len(plan.BaseTarget) > 0 {
+		if cleanup, err = OpenHoldCleanup(); err != nil {
+			return
+		}
+		// snapshots may be in different pools, bookmarks can't be held
+		if strings.Contains(plan.Base, "@") {
+			if err = HoldSnapshots(map[string]string{plan.Base: tag}, cleanup); err != nil {
+				return
+			}
+		}
+		if err = HoldSnapshots(map[string]string{plan.BaseTarget: tag}, cleanup); err != nil {
+			return
+		}
+	}
+	for _, stream := range plan.Streams {
+		var r RecvResult
+		r, err = replTransfer(target, &recvOpts, func(w io.Writer) (err error) {
+			return replSend(stream, w, sendOpts)
+		})
+		received(r)
+		if err != nil {
+			return
+		}
+	}
+	// release holds before pruning, target base of bookmark incremental
+	// is pruned since its source snapshot is gone
+	if cleanup != nil {
+		cleanup.Close()
+		cleanup = nil
+	}
+	if opts.Raw && (len(plan.Streams) > 0 || len(res.Resumed) > 0) {
+		if err = replEncryptionRoot(source, target); err != nil {
+			return
+		}
+	}
+	if opts.Prune {
+		if dst, _, err = replSnapshots(target); err != nil {
+			return
+		}
+		prune := replPrune(src, dst)
+		if len(prune) == 0 {
+			return
+		}
+		var snaps []string
+		for _, name := range prune {
+			snaps = append(snaps, name[strings.Index(name, "@")+1:])
+		}
+		var destroy SnapshotDestroyPlan
+		if destroy, err = PlanSnapshotDestroy(target + "@" + strings.Join(snaps, ",")); err != nil {
+			return
+		}
+		if err = destroy.Execute(false); err != nil {
+			return
+		}
+		res.Pruned = prune
+	}
+	return
+}
+
+// replSend - write stream of replication plan to w
+func replSend(stream replStream, w io.Writer, opts SendOptions) (err error) {
+	var snap Dataset
+	if snap, err = DatasetOpenSingle(stream.To); err != nil {
+		return
+	}
+	defer snap.Close()
+	opts.DoAll = stream.All
+	return snap.SendWithOptions(w, stream.From, opts)
+}
+
+// replResume - resume interrupted receive into target if there is one,
+// returns name of resumed snapshot
+func replResume(target string, src []replSnapshot, opts *ReplicateOptions,
+	sendOpts SendOptions, recvOpts RecvOptions, received func(RecvResult)) (resumed string, err error) {
+	var token string
+	if prop, perr := datasetProperty(target, DatasetPropReceiveResumeToken); perr == nil &&
+		len(prop.Value) > 0 && prop.Value != "-" {
+		token = prop.Value
+	}
+	if len(token) == 0 {
+		return
+	}
+	var info ResumeTokenInfo
+	if info, err = DecodeResumeToken(token); err != nil {
+		return
+	}
+	for _, s := range src {
+		if s.GUID == info.ToGUID {
+			resumed = s.Name
+			break
+		}
+	}
+	if len(resumed) == 0 {
+		if !opts.Force {
+			err = NewError(EExists, fmt.Sprintf("'%s' has partial receive state of snapshot '%s' which is not on source", target, info.ToName))
+			return
+		}
+		err = AbortResumable(target)
+		return
+	}
+	flags := info.SendFlags()
+	sendOpts.EmbedData, sendOpts.Compress = flags.EmbedData, flags.Compress
+	sendOpts.LargeBlock, sendOpts.Raw = flags.LargeBlock, flags.Raw
+	recvOpts.Resumable = true
+	var r RecvResult
+	r, err = replTransfer(target, &recvOpts, func(w io.Writer) error {
+		return SendResumeWithOptions(w, token, sendOpts)
+	})
+	received(r)
+	return
+}
+
+// replEncryptionRoot - raw receive makes every received dataset its own
+// encryption root. Fix encryption root of target to match source: target
+// is root if source is, otherwise it inherits encryption root of its
+// parent if that is replica of source encryption root, so it shares the
+// wrapping key.
+func replEncryptionRoot(source, target string) (err error) {
+	srcRoot := encryptionRoot(source)
+	if len(srcRoot) == 0 {
+		return
+	}
+	srcIsRoot, dstIsRoot := srcRoot == source, encryptionRoot(target) == target
+	switch {
+	case srcIsRoot && !dstIsRoot:
+		err = forceEncryptionRoot(target, false)
+	case !srcIsRoot && dstIsRoot:
+		i := strings.LastIndex(target, "/")
+		if i < 0 {
+			return
+		}
+		parentRoot := encryptionRoot(target[:i])
+		if len(parentRoot) == 0 {
+			return
+		}
+		var replica bool
+		if replica, err = replIsReplica(srcRoot, parentRoot); err != nil || !replica {
+			return
+		}
+		err = forceEncryptionRoot(target, true)
+	}
+	return
+}
+
+// replIsReplica - true if datasets a and b have snapshot of the same guid
+func replIsReplica(a, b string) (replica bool, err error) {
+	var snapsA, snapsB []replSnapshot
+	if snapsA, _, err = replSnapshots(a); err != nil {
+		return
+	}
+	if snapsB, _, err = replSnapshots(b); err != nil {
+		return
+	}
+	plan, perr := planReplicate(snapsA, nil, snapsB)
+	replica = perr == nil && len(plan.BaseTarget) > 0
+	return
+}
@@ -0,0 +1,65 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanReplicate(t *testing.T) {
+	src := []replSnapshot{
+		{"pool/src@a", 1, 10},
+		{"pool/src@b", 2, 20},
+		{"pool/src@c", 3, 30},
+		{"pool/src@d", 4, 40},
+	}
+	bookmarks := []replSnapshot{{"pool/src#b", 2, 20}, {"pool/src#x", 9, 25}}
+	for _, tc := range []struct {
+		name      string
+		src, dst  []replSnapshot
+		bookmarks []replSnapshot
+		base      string
+		streams   []replStream
+		fails     bool
+	}{
+		{name: "empty target", src: src, streams: []replStream{
+			{To: "pool/src@a"},
+			{From: "pool/src@a", To: "pool/src@d", All: true},
+		}},
+		{name: "single snapshot", src: src[:1], streams: []replStream{{To: "pool/src@a"}}},
+		{name: "incremental", src: src, dst: []replSnapshot{{"bk/dst@a", 1, 5}, {"bk/dst@b", 2, 6}},
+			base: "pool/src@b", streams: []replStream{{From: "pool/src@b", To: "pool/src@d", All: true}}},
+		{name: "up to date", src: src, dst: []replSnapshot{{"bk/dst@d", 4, 9}}, base: "pool/src@d"},
+		{name: "bookmark", src: src[2:], bookmarks: bookmarks, dst: []replSnapshot{{"bk/dst@b", 2, 6}},
+			base: "pool/src#b", streams: []replStream{
+				{From: "pool/src#b", To: "pool/src@c"},
+				{From: "pool/src@c", To: "pool/src@d", All: true},
+			}},
+		{name: "bookmark last", src: src[3:], bookmarks: bookmarks, dst: []replSnapshot{{"bk/dst@x", 9, 6}},
+			base: "pool/src#x", streams: []replStream{{From: "pool/src#x", To: "pool/src@d"}}},
+		{name: "no common", src: src, bookmarks: bookmarks, dst: []replSnapshot{{"bk/dst@z", 7, 6}}, fails: true},
+		{name: "no source snapshots", dst: []replSnapshot{{"bk/dst@a", 1, 6}}, fails: true},
+	} {
+		plan, err := planReplicate(tc.src, tc.bookmarks, tc.dst)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected failure, got plan %+v", tc.name, plan)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if plan.Base != tc.base || !reflect.DeepEqual(plan.Streams, tc.streams) {
+			t.Errorf("%s: base %q streams %+v, expected %q %+v", tc.name, plan.Base, plan.Streams, tc.base, tc.streams)
+		}
+	}
+}
+
+func TestReplPrune(t *testing.T) {
+	src := []replSnapshot{{"pool/src@b", 2, 20}, {"pool/src@c", 3, 30}}
+	dst := []replSnapshot{{"bk/dst@a", 1, 5}, {"bk/dst@b", 2, 6}, {"bk/dst@old", 8, 7}, {"bk/dst@c", 3, 8}}
+	if prune := replPrune(src, dst); !reflect.DeepEqual(prune, []string{"bk/dst@a", "bk/dst@old"}) {
+		t.Errorf("unexpected snapshots to prune %v", prune)
+	}
+}
@@ -0,0 +1,135 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "common.h"
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"time"
+	"unsafe"
+)
+
+// SendOptions - send flags and options not known to libzfs
+type SendOptions struct {
+	SendFlags
+	// OnProgress is called every ProgressInterval while stream is written.
+	// Progress of deduplicated streams is not reported.
+	OnProgress func(SendProgress)
+	// ProgressInterval defaults to one second
+	ProgressInterval time.Duration
+	// RedactBookmark sends snapshot redacted by redaction bookmark of its
+	// filesystem created by Redact (send --redact), OpenZFS 2.0 and newer.
+	// Replicated and intermediary sends can't be redacted.
+	RedactBookmark string
+}
+
+// SendProgress - progress of running send
+type SendProgress struct {
+	Snapshot      string `json:"snapshot"`       // snapshot currently being sent
+	BytesWritten  uint64 `json:"bytes_written"`  // bytes of whole stream written so far
+	TotalEstimate uint64 `json:"total_estimate"` // estimated size of whole stream, 0 if unknown
+	BlocksVisited uint64 `json:"blocks_visited"` // of current snapshot, libzfs 2.0 and newer
+}
+
+// sendProgress - query progress of send of snapshot name to fd
+func sendProgress(name string, fd uintptr) (bytes, blocks uint64, ok bool) {
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	var cbytes, cblocks C.uint64_t
+	if C.dataset_send_progress(csName, C.int(fd), &cbytes, &cblocks) != 0 {
+		return
+	}
+	return uint64(cbytes), uint64(cblocks), true
+}
+
+// stepsEstimate - estimate of total size of streams, 0 if unknown
+func stepsEstimate(steps []sendStep, flags *SendFlags) (total uint64) {
+	for _, step := range steps {
+		space, err := sendSpace(step, flags)
+		if err != nil {
+			return 0
+		}
+		total += space
+	}
+	return
+}
+
+// startSendProgress - poll progress of send to fd of snapshots names until
+// returned stop is called. Total estimate is computed in background by
+// estimate if not nil.
+func startSendProgress(opts *SendOptions, fd uintptr, names []string,
+	estimate func() uint64) (stop func()) {
+	if opts == nil || opts.OnProgress == nil || len(names) == 0 {
+		return func() {}
+	}
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		var total uint64
+		totalc := make(chan uint64, 1)
+		if estimate != nil {
+			go func() { totalc <- estimate() }()
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		// finished snapshots may be sent in different order than listed
+		sent := make([]bool, len(names))
+		var cur int
+		var seen bool
+		var completed, last uint64
+		for {
+			select {
+			case <-done:
+				return
+			case total = <-totalc:
+				continue
+			case <-ticker.C:
+			}
+			for i := 0; i < len(names); i++ {
+				j := (cur + i) % len(names)
+				if sent[j] {
+					continue
+				}
+				bytes, blocks, ok := sendProgress(names[j], fd)
+				if !ok {
+					continue
+				}
+				if j != cur && seen {
+					sent[cur] = true
+					completed += last
+				}
+				cur, seen, last = j, true, bytes
+				opts.OnProgress(SendProgress{
+					Snapshot:      names[j],
+					BytesWritten:  completed + bytes,
+					TotalEstimate: total,
+					BlocksVisited: blocks,
+				})
+				break
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// sendStepsProgress - start progress polling of send of steps
+func sendStepsProgress(opts *SendOptions, fd uintptr, steps []sendStep) (stop func()) {
+	names := make([]string, 0, len(steps))
+	for _, step := range steps {
+		names = append(names, step.To)
+	}
+	return startSendProgress(opts, fd, names, func() uint64 {
+		return stepsEstimate(steps, &opts.SendFlags)
+	})
+}
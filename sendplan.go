@@ -0,0 +1,236 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "common.h"
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// sendStep - single stream of snapshot To, incremental from From snapshot
+// or bookmark, full stream if From is empty
+type sendStep struct {
+	From string
+	To   string
+}
+
+// sendFromName - full name of incremental source given as full name,
+// @snap, #bookmark or short snapshot name relative to fsname
+func sendFromName(fsname, fromName string) string {
+	switch {
+	case len(fromName) == 0:
+		return ""
+	case fromName[0] == '@' || fromName[0] == '#':
+		return fsname + fromName
+	case !strings.ContainsAny(fromName, "@#"):
+		return fsname + "@" + fromName
+	}
+	return fromName
+}
+
+// sendSteps - list streams libzfs writes when sending dataset d incremental
+// from fromName with flags, in order they are sent (order of filesystems of
+// replicated send may differ)
+func (d *Dataset) sendSteps(fromName string, flags *SendFlags) (steps []sendStep, err error) {
+	var path string
+	if path, err = d.Path(); err != nil {
+		return
+	}
+	at := strings.Index(path, "@")
+	if at < 0 {
+		// filesystem, volume or bookmark sent by SendOne
+		steps = []sendStep{{From: fromName, To: path}}
+		return
+	}
+	fsname, snapname := path[:at], path[at+1:]
+	from := sendFromName(fsname, fromName)
+	if len(from) == 0 && flags.FromOrigin {
+		var origin PropertyValue
+		if origin, err = datasetProperty(fsname, DatasetPropOrigin); err != nil {
+			return
+		}
+		if origin.Value != "-" {
+			from = origin.Value
+		}
+	}
+	if !flags.Replicate && !flags.DoAll {
+		steps = []sendStep{{From: from, To: path}}
+		return
+	}
+	var fs Dataset
+	if fs, err = DatasetOpen(fsname); err != nil {
+		return
+	}
+	defer fs.Close()
+	if !flags.Replicate {
+		return sendChain(&fs, from, snapname, true)
+	}
+	// children of replicated stream are sent from snapshot of the same name
+	fromShort := ""
+	if i := strings.IndexAny(from, "@#"); i >= 0 {
+		fromShort = from[i:]
+	}
+	var walk func(ds *Dataset) error
+	walk = func(ds *Dataset) (err error) {
+		var chain []sendStep
+		dsFrom := ""
+		if len(fromShort) > 0 {
+			dsFrom = ds.Properties[DatasetPropName].Value + fromShort
+		}
+		if chain, err = sendChain(ds, dsFrom, snapname, flags.DoAll); err != nil {
+			return
+		}
+		steps = append(steps, chain...)
+		for i := range ds.Children {
+			if !ds.Children[i].IsSnapshot() {
+				if err = walk(&ds.Children[i]); err != nil {
+					return
+				}
+			}
+		}
+		return
+	}
+	err = walk(&fs)
+	return
+}
+
+// datasetProperty - read property of dataset given by name
+func datasetProperty(name string, p DatasetProp) (prop PropertyValue, err error) {
+	var fs Dataset
+	if fs, err = DatasetOpenSingle(name); err != nil {
+		return
+	}
+	defer fs.Close()
+	return fs.GetProperty(p)
+}
+
+// sendChain - streams of all snapshots of opened filesystem fs after from up
+// to snapshot named to if all is set (-I), otherwise just stream of to (-i).
+// If from is empty or does not exist in fs, first snapshot is sent as full
+// stream. Filesystem without snapshot to gives no streams.
+func sendChain(fs *Dataset, from, to string, all bool) (steps []sendStep, err error) {
+	var snaps []Dataset
+	for _, ch := range fs.Children {
+		if ch.IsSnapshot() {
+			snaps = append(snaps, ch)
+		}
+	}
+	sort.Sort(snapshotsCreateAsc(snaps))
+	fsname := fs.Properties[DatasetPropName].Value
+	toIdx := -1
+	for i := range snaps {
+		if snaps[i].Properties[DatasetPropName].Value == fsname+"@"+to {
+			toIdx = i
+			break
+		}
+	}
+	if toIdx < 0 {
+		return
+	}
+	prev, start := "", 0
+	if len(from) > 0 {
+		var src Dataset
+		if src, err = DatasetOpenSingle(from); err != nil {
+			if e, ok := err.(*Error); ok && e.ErrorCode() == ENoent {
+				// filesystem created after from snapshot
+				err = nil
+			} else {
+				return
+			}
+		} else {
+			fromTxg, _ := strconv.ParseUint(src.Properties[DatasetPropCreateTXG].Value, 10, 64)
+			src.Close()
+			prev, start = from, len(snaps)
+			for i := range snaps {
+				txg, _ := strconv.ParseUint(snaps[i].Properties[DatasetPropCreateTXG].Value, 10, 64)
+				if txg > fromTxg {
+					start = i
+					break
+				}
+			}
+		}
+	}
+	if !all && start <= toIdx {
+		start = toIdx
+	}
+	for i := start; i <= toIdx; i++ {
+		name := snaps[i].Properties[DatasetPropName].Value
+		steps = append(steps, sendStep{From: prev, To: name})
+		prev = name
+	}
+	return
+}
+
+// sendSpace - estimate size of stream of single step with lzc_send_space
+func sendSpace(step sendStep, flags *SendFlags) (space uint64, err error) {
+	cflags := to_sendflags_t(flags)
+	defer C.free(unsafe.Pointer(cflags))
+	csTo := C.CString(step.To)
+	defer C.free(unsafe.Pointer(csTo))
+	var csFrom *C.char
+	if len(step.From) > 0 {
+		csFrom = C.CString(step.From)
+		defer C.free(unsafe.Pointer(csFrom))
+	}
+	var cspace C.uint64_t
+	if rc := C.dataset_send_space(csTo, csFrom, cflags, &cspace); rc != 0 {
+		err = errnoError(syscall.Errno(rc), "cannot estimate send size of '"+step.To+"'")
+		return
+	}
+	space = uint64(cspace)
+	return
+}
+
+// SendStreamSize - estimated size of stream of single snapshot
+type SendStreamSize struct {
+	From string `json:"from,omitempty"` // incremental source, empty for full stream
+	To   string `json:"to"`
+	Size uint64 `json:"size"`
+}
+
+// SendEstimate - estimated size of send, per snapshot stream
+type SendEstimate struct {
+	Streams []SendStreamSize `json:"streams"`
+	Total   uint64           `json:"total"`
+}
+
+// SendEstimate - estimate size of stream sent by Send or SendFrom of
+// snapshot with the same FromName and flags without sending anything.
+// FromName can be snapshot or bookmark (full name, @snap or #bookmark).
+// Replicated (Replicate) and intermediary (DoAll) sends are estimated per
+// snapshot stream. Size of stream headers and properties is not included.
+func (d *Dataset) SendEstimate(FromName string, flags SendFlags) (est SendEstimate, err error) {
+	var path string
+	if path, err = d.Path(); err != nil {
+		return
+	}
+	if d.Type != DatasetTypeSnapshot {
+		err = NewError(EBadtype, "'"+path+"' is not a snapshot")
+		return
+	}
+	if flags.Replicate && len(FromName) == 0 {
+		flags.DoAll = true
+	}
+	var steps []sendStep
+	if steps, err = d.sendSteps(FromName, &flags); err != nil {
+		return
+	}
+	est.Streams = make([]SendStreamSize, 0, len(steps))
+	for _, step := range steps {
+		var size uint64
+		if size, err = sendSpace(step, &flags); err != nil {
+			return
+		}
+		est.Streams = append(est.Streams, SendStreamSize{From: step.From, To: step.To, Size: size})
+		est.Total += size
+	}
+	return
+}
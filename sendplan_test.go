@@ -0,0 +1,18 @@
+package zfs
+
+import "testing"
+
+func TestSendFromName(t *testing.T) {
+	for _, tc := range []struct{ from, expected string }{
+		{"", ""},
+		{"@a", "pool/fs@a"},
+		{"#bm", "pool/fs#bm"},
+		{"a", "pool/fs@a"},
+		{"pool/other@a", "pool/other@a"},
+		{"pool/fs#bm", "pool/fs#bm"},
+	} {
+		if name := sendFromName("pool/fs", tc.from); name != tc.expected {
+			t.Errorf("sendFromName(%q) = %q, expected %q", tc.from, name, tc.expected)
+		}
+	}
+}
@@ -8,14 +8,11 @@ package zfs
 // #include <string.h>
 import "C"
 import (
+	"bytes"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
-	"path"
-	"regexp"
-	"strconv"
 	"strings"
-	"time"
 	"unsafe"
 )
 
@@ -43,6 +40,18 @@ func to_sendflags_t(flags *SendFlags) (cflags *C.sendflags_t) {
 	if flags.Raw {
 		C.sendflags_set_raw(cflags)
 	}
+	C.sendflags_set_ex(cflags, booleanT(flags.Backup), booleanT(flags.Holds), booleanT(flags.Saved))
+	return
+}
+
+// checkSendFlags - fail on flags libzfs does not support instead of
+// silently sending stream without them
+func checkSendFlags(flags *SendFlags) (err error) {
+	if C.LIBZFS_VERSION_MAJOR == 0 && C.LIBZFS_VERSION_MINOR == 7 && (flags.Raw || flags.Backup) {
+		err = NewError(ENotsup, "raw and backup sends require libzfs 0.8 or newer.")
+	} else if C.LIBZFS_VERSION_MAJOR < 2 && (flags.Holds || flags.Saved) {
+		err = NewError(ENotsup, "sending holds and saved send require OpenZFS 2.0 or newer.")
+	}
 	return
 }
 
@@ -60,21 +69,46 @@ func to_recvflags_t(flags *RecvFlags) (cflags *C.recvflags_t) {
 	return
 }
 
-func (d *Dataset) send(FromName string, outf *os.File, flags *SendFlags) (err error) {
+func (d *Dataset) send(FromName string, outf io.Writer, opts *SendOptions) (err error) {
 	var cfromname, ctoname *C.char
 	var dpath string
 	var pd Dataset
+	var steps []sendStep
+	flags := &opts.SendFlags
 
-	if d.Type != DatasetTypeSnapshot || (len(FromName) > 0 && strings.Contains(FromName, "#")) {
+	if d.Type != DatasetTypeSnapshot {
 		err = NewError(ENotsup, "Unsupported method on filesystem or bookmark. Use func SendOne() for that purpose.")
 		return
 	}
+	if flags.Saved {
+		err = NewError(ENotsup, "Saved state is sent by func SendSaved().")
+		return
+	}
+	if err = checkSendFlags(flags); err != nil {
+		return
+	}
+	if strings.Contains(FromName, "#") || len(opts.RedactBookmark) > 0 {
+		// single stream, the way zfs send does it
+		if flags.Replicate || flags.DoAll {
+			err = NewError(ENotsup, "multiple snapshots cannot be sent from a bookmark or redacted.")
+			return
+		}
+		if flags.Props || flags.Dedup || flags.DryRun || flags.Backup {
+			err = NewError(ENotsup, "Unsupported flag with send from a bookmark or redacted send.")
+			return
+		}
+		return d.sendOne(FromName, outf, opts)
+	}
 
 	cflags := to_sendflags_t(flags)
 	defer C.free(unsafe.Pointer(cflags))
 	if dpath, err = d.Path(); err != nil {
 		return
 	}
+	if opts.OnProgress != nil {
+		// progress is best effort, don't fail send
+		steps, _ = d.sendSteps(FromName, flags)
+	}
 	sendparams := strings.Split(dpath, "@")
 	parent := sendparams[0]
 	if len(FromName) > 0 {
@@ -95,160 +129,333 @@ func (d *Dataset) send(FromName string, outf *os.File, flags *SendFlags) (err er
 		return
 	}
 	defer pd.Close()
-	cerr := C.zfs_send(pd.list.zh, cfromname, ctoname, cflags, C.int(outf.Fd()), nil, nil, nil)
-	if cerr != 0 {
-		err = LastError()
-	}
+	err = withWriteFd(outf, func(fd uintptr) error {
+		defer sendStepsProgress(opts, fd, steps)()
+		if C.zfs_send(pd.list.zh, cfromname, ctoname, cflags, C.int(fd), nil, nil, nil) != 0 {
+			return LastError()
+		}
+		return nil
+	})
 	return
 }
 
-func (d *Dataset) SendOne(FromName string, outf *os.File, flags *SendFlags) (err error) {
-	var cfromname, ctoname *C.char
-	var dpath string
-
+// SendOne - send filesystem, volume or bookmark state as a single stream
+// (without properties and children) to outf, optionally incremental from
+// FromName bookmark or snapshot.
+func (d *Dataset) SendOne(FromName string, outf io.Writer, flags *SendFlags) (err error) {
+	return d.SendOneWithOptions(FromName, outf, SendOptions{SendFlags: *flags})
+}
 
+// SendOneWithOptions - same as SendOne with options e.g. progress reporting
+func (d *Dataset) SendOneWithOptions(FromName string, outf io.Writer, opts SendOptions) (err error) {
+	flags := &opts.SendFlags
 	if d.Type == DatasetTypeSnapshot || (len(FromName) > 0 && !strings.Contains(FromName, "#")) {
 		err = NewError(ENotsup, "Unsupported with snapshot. Use func Send() for that purpose.")
 		return
 	}
-	if flags.Replicate || flags.DoAll || flags.Props || flags.Dedup || flags.DryRun {
+	if flags.Replicate || flags.DoAll || flags.Props || flags.Dedup || flags.DryRun || flags.Backup {
 		err = NewError(ENotsup, "Unsupported flag with filesystem or bookmark.")
 		return
 	}
+	return d.sendOne(FromName, outf, &opts)
+}
 
-	cflags := to_sendflags_t(flags)
+// sendOne - send single stream of d (filesystem, volume, bookmark or
+// snapshot) with lzc_send, incremental from FromName snapshot or bookmark
+// given as full name, @snap or #bookmark
+func (d *Dataset) sendOne(FromName string, outf io.Writer, opts *SendOptions) (err error) {
+	var cfromname, credact *C.char
+	var dpath string
+
+	if opts.Saved {
+		err = NewError(ENotsup, "Saved state is sent by func SendSaved().")
+		return
+	}
+	if err = checkSendFlags(&opts.SendFlags); err != nil {
+		return
+	}
+	if len(opts.RedactBookmark) > 0 {
+		if C.LIBZFS_VERSION_MAJOR < 2 {
+			err = NewError(ENotsup, "redacted send requires OpenZFS 2.0 or newer.")
+			return
+		}
+		credact = C.CString(bookmarkShortName(opts.RedactBookmark))
+		defer C.free(unsafe.Pointer(credact))
+	}
+	cflags := to_sendflags_t(&opts.SendFlags)
 	defer C.free(unsafe.Pointer(cflags))
 
 	if dpath, err = d.Path(); err != nil {
 		return
 	}
 	if len(FromName) > 0 {
-		if FromName[0] == '#' || FromName[0] == '@' {
-			FromName = dpath + FromName
-		}
+		FromName = sendFromName(strings.SplitN(dpath, "@", 2)[0], FromName)
 		cfromname = C.CString(FromName)
 		defer C.free(unsafe.Pointer(cfromname))
 	}
-	ctoname = C.CString(path.Base(dpath))
-	defer C.free(unsafe.Pointer(ctoname))
-	cerr := C.gozfs_send_one(d.list.zh, cfromname, C.int(outf.Fd()), cflags, nil)
-	if cerr != 0 {
-		err = LastError()
-	}
+	steps := []sendStep{{From: FromName, To: dpath}}
+	err = withWriteFd(outf, func(fd uintptr) error {
+		defer sendStepsProgress(opts, fd, steps)()
+		if C.gozfs_send_one(d.list.zh, cfromname, C.int(fd), cflags, credact) != 0 {
+			return LastError()
+		}
+		return nil
+	})
 	return
 }
 
-func (d *Dataset) Send(outf *os.File, flags SendFlags) (err error) {
-	if flags.Replicate {
-		flags.DoAll = true
+// Send - send snapshot stream to outf. Any io.Writer can be used, data are
+// passed to writers other than *os.File through a pipe.
+func (d *Dataset) Send(outf io.Writer, flags SendFlags) (err error) {
+	return d.SendWithOptions(outf, "", SendOptions{SendFlags: flags})
+}
+
+// SendWithOptions - send snapshot stream to outf with options e.g. progress
+// reporting, incremental from FromName if not empty (see SendFrom).
+func (d *Dataset) SendWithOptions(outf io.Writer, FromName string, opts SendOptions) (err error) {
+	if len(FromName) > 0 {
+		return d.sendFrom(FromName, outf, &opts)
 	}
-	err = d.send("", outf, &flags)
+	if opts.Replicate {
+		opts.DoAll = true
+	}
+	err = d.send("", outf, &opts)
 	return
 }
 
-func (d *Dataset) SendFrom(FromName string, outf *os.File, flags SendFlags) (err error) {
+// SendFrom - send incremental snapshot stream from FromName snapshot,
+// bookmark (pool/fs#bookmark or #bookmark) or origin to outf. Stream from
+// bookmark is always a single snapshot stream.
+func (d *Dataset) SendFrom(FromName string, outf io.Writer, flags SendFlags) (err error) {
+	return d.sendFrom(FromName, outf, &SendOptions{SendFlags: flags})
+}
+
+func (d *Dataset) sendFrom(FromName string, outf io.Writer, opts *SendOptions) (err error) {
 	var porigin PropertyValue
-	var from, dest []string
+	var dpath string
 	if err = d.ReloadProperties(); err != nil {
 		return
 	}
 	porigin, _ = d.GetProperty(DatasetPropOrigin)
 	if len(porigin.Value) > 0 && porigin.Value == FromName {
-		FromName = ""
-		flags.FromOrigin = true
-	} else {
-		var dpath string
-		if dpath, err = d.Path(); err != nil {
-			return
-		}
-		dest = strings.Split(dpath, "@")
-		from = strings.Split(FromName, "@")
-
-		if len(from[0]) > 0 && from[0] != dest[0] {
-			err = NewError(ENotsup, "incremental source must be in same filesystem.")
-			return
-		}
-		if len(from) < 2 || strings.Contains(from[1], "@") || strings.Contains(from[1], "/") {
-			err = NewError(ENotsup, "invalid incremental source.")
-			return
-		}
+		opts.FromOrigin = true
+		return d.send("", outf, opts)
+	}
+	if dpath, err = d.Path(); err != nil {
+		return
 	}
-	err = d.send("@"+from[1], outf, &flags)
+	dest := strings.Split(dpath, "@")
+	sep := strings.IndexAny(FromName, "@#")
+	if sep < 0 {
+		err = NewError(ENotsup, "invalid incremental source.")
+		return
+	}
+	if sep > 0 && FromName[:sep] != dest[0] {
+		err = NewError(ENotsup, "incremental source must be in same filesystem.")
+		return
+	}
+	if short := FromName[sep+1:]; len(short) == 0 || strings.ContainsAny(short, "@#/") {
+		err = NewError(ENotsup, "invalid incremental source.")
+		return
+	}
+	err = d.send(FromName[sep:], outf, opts)
 	return
 }
 
-// SendSize - estimate snapshot size to transfer
+// SendSize - estimate snapshot size to transfer, see SendEstimate for
+// per snapshot sizes
 func (d *Dataset) SendSize(FromName string, flags SendFlags) (size int64, err error) {
-	var r, w *os.File
-	errch := make(chan error)
-	defer func() {
-		select {
-		case <-errch:
-		default:
-		}
-		close(errch)
-	}()
-	flags.DryRun = true
-	flags.Verbose = true
-	flags.Progress = true
-	flags.Parsable = true
-	if r, w, err = os.Pipe(); err != nil {
-		return
-	}
-	defer r.Close()
-	go func() {
-		var tmpe error
-		saveOut := C.redirect_libzfs_stdout(C.int(w.Fd()))
-		if saveOut < 0 {
-			tmpe = NewError(ENotsup, fmt.Sprintf("Redirection of zfslib stdout failed %d", saveOut))
-		} else {
-			tmpe = d.send(FromName, w, &flags)
-			C.restore_libzfs_stdout(saveOut)
-		}
-		w.Close()
-		errch <- tmpe
-	}()
-
-	r.SetReadDeadline(time.Now().Add(15 * time.Second))
-	var data []byte
-	if data, err = ioutil.ReadAll(r); err != nil {
-		return
-	}
-	// parse size
-	var sizeRe *regexp.Regexp
-	if sizeRe, err = regexp.Compile("size[ \t]*([0-9]+)"); err != nil {
-		return
-	}
-	matches := sizeRe.FindAllSubmatch(data, 3)
-	if len(matches) > 0 && len(matches[0]) > 1 {
-		if size, err = strconv.ParseInt(
-			string(matches[0][1]), 10, 64); err != nil {
-			return
-		}
+	var est SendEstimate
+	if est, err = d.SendEstimate(FromName, flags); err != nil {
+		return
 	}
-	err = <-errch
+	size = int64(est.Total)
+	return
+}
+
+// RecvOptions - receive flags and properties of received dataset
+type RecvOptions struct {
+	RecvFlags
+	// SetProps overrides received properties (-o property=value), origin
+	// receives incremental stream as a clone of given snapshot
+	SetProps map[string]string
+	// ExcludeProps are not received and inherited instead (-x property)
+	ExcludeProps []string
+}
+
+// Receive - receive snapshot stream. Any io.Reader can be used, data from
+// readers other than *os.File are passed through a pipe.
+func (d *Dataset) Receive(inf io.Reader, flags RecvFlags) (err error) {
+	_, err = d.ReceiveWithOptions(inf, RecvOptions{RecvFlags: flags})
 	return
 }
 
-// Receive - receive snapshot stream
-func (d *Dataset) Receive(inf *os.File, flags RecvFlags) (err error) {
+// ReceiveWithOptions - receive snapshot stream with options, see Receive.
+// Returned result describes received datasets, on failure it reports
+// resumable state if receive was Resumable.
+func (d *Dataset) ReceiveWithOptions(inf io.Reader, opts RecvOptions) (res RecvResult, err error) {
 	var dpath string
 	if dpath, err = d.Path(); err != nil {
 		return
 	}
-	props := C.new_property_nvlist()
-	if props == nil {
-		err = NewError(ENomem, "Out of memory func (d *Dataset) Recv()")
+	return receive(dpath, inf, &opts)
+}
+
+// receive - receive stream from inf into dataset or snapshot named dpath,
+// which does not have to exist
+func receive(dpath string, inf io.Reader, opts *RecvOptions) (res RecvResult, err error) {
+	// file is passed to libzfs directly, seeking back after peeking at its
+	// BEGIN record, and bytes read are told by file offset. Bytes of other
+	// readers are counted as fed to the pipe.
+	f, isFile := inf.(*os.File)
+	var start int64
+	if isFile {
+		if start, err = f.Seek(0, io.SeekCurrent); err != nil {
+			isFile, err = false, nil
+		}
+	}
+	begin, peeked := peekStreamBegin(inf)
+	stream := inf
+	var counter *countingReader
+	if isFile {
+		if _, err = f.Seek(start, io.SeekStart); err != nil {
+			return
+		}
+	} else {
+		counter = &countingReader{r: io.MultiReader(bytes.NewReader(peeked), inf)}
+		stream = counter
+	}
+	ok := begin != nil
+	var typ DatasetType
+	if ok {
+		typ = recvDatasetType(begin.ObjsetType)
+	}
+	var props *C.nvlist_t
+	if props, err = recvPropsNvlist(opts, typ); err != nil {
 		return
 	}
 	defer C.nvlist_free(props)
-	cflags := to_recvflags_t(&flags)
+	cflags := to_recvflags_t(&opts.RecvFlags)
 	defer C.free(unsafe.Pointer(cflags))
 	dest := C.CString(dpath)
 	defer C.free(unsafe.Pointer(dest))
-	ec := C.zfs_receive(C.libzfs_get_handle(), dest, nil, cflags, C.int(inf.Fd()), nil)
-	if ec != 0 {
-		err = LastError()
+
+	var before map[string]string
+	if ok {
+		res.Dataset = recvTarget(dpath, begin.ToName, &opts.RecvFlags)
+		res.FromGUID = begin.FromGUID
+		before = snapshotGUIDs(res.Dataset)
+	}
+	err = withReadFd(stream, func(fd uintptr) error {
+		if C.zfs_receive(C.libzfs_get_handle(), dest, props, cflags, C.int(fd), nil) != 0 {
+			return LastError()
+		}
+		return nil
+	})
+	if isFile {
+		if end, serr := f.Seek(0, io.SeekCurrent); serr == nil {
+			res.BytesRead = uint64(end - start)
+		}
+	} else {
+		res.BytesRead = counter.count()
+	}
+	if !ok || opts.DryRun {
+		return
+	}
+	if err != nil {
+		if opts.Resumable {
+			res.ResumeToken, res.Resumable = resumeState(res.Dataset)
+		}
+		return
+	}
+	res.Snapshots = receivedSnapshots(res.Dataset, before)
+	res.EncryptionRoot = encryptionRoot(res.Dataset)
+	return
+}
+
+// recvDatasetType - dataset type of stream BEGIN record drr_type, zero if
+// it is not filesystem or volume
+func recvDatasetType(objset uint32) DatasetType {
+	switch objset {
+	case C.DMU_OST_ZFS:
+		return DatasetTypeFilesystem
+	case C.DMU_OST_ZVOL:
+		return DatasetTypeVolume
+	}
+	return 0
+}
+
+// recvPropsNvlist - nvlist of received properties overrides as name -> value
+// and exclusions as boolean name, caller has to free it. Values are checked
+// for received dataset type typ, zero if stream did not tell.
+func recvPropsNvlist(opts *RecvOptions, typ DatasetType) (props *C.nvlist_t, err error) {
+	if C.LIBZFS_VERSION_MAJOR == 0 && C.LIBZFS_VERSION_MINOR == 7 {
+		_, origin := opts.SetProps["origin"]
+		if len(opts.ExcludeProps) > 0 || len(opts.SetProps) > 1 || (len(opts.SetProps) == 1 && !origin) {
+			err = NewError(ENotsup, "receive property overrides other than origin are not supported by libzfs")
+			return
+		}
+	}
+	for name, value := range opts.SetProps {
+		if err = validateRecvProperty(name, value, false, typ); err != nil {
+			return
+		}
+	}
+	for _, name := range opts.ExcludeProps {
+		if _, ok := opts.SetProps[name]; ok {
+			err = NewError(EBadprop, fmt.Sprintf("'%s' cannot be both set and excluded", name))
+			return
+		}
+		if err = validateRecvProperty(name, "", true, typ); err != nil {
+			return
+		}
+	}
+	props = C.fnvlist_alloc()
+	for name, value := range opts.SetProps {
+		csName := C.CString(name)
+		csValue := C.CString(value)
+		C.fnvlist_add_string(props, csName, csValue)
+		C.free(unsafe.Pointer(csName))
+		C.free(unsafe.Pointer(csValue))
+	}
+	for _, name := range opts.ExcludeProps {
+		csName := C.CString(name)
+		C.fnvlist_add_boolean(props, csName)
+		C.free(unsafe.Pointer(csName))
+	}
+	return
+}
+
+// validateRecvProperty - check property override or exclusion of received
+// dataset of type typ. Without type value has to be valid for filesystem or
+// volume, libzfs does final check.
+func validateRecvProperty(name, value string, exclude bool, typ DatasetType) (err error) {
+	if name == "origin" && !exclude {
+		return
+	}
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	if C.zfs_prop_user(csName) != 0 {
+		return
+	}
+	prop := C.zfs_name_to_prop(csName)
+	if prop == C.ZPROP_INVAL {
+		return NewError(EBadprop, fmt.Sprintf("invalid property '%s'", name))
+	}
+	if exclude {
+		if C.zfs_prop_readonly(prop) != 0 && C.zfs_prop_setonce(prop) == 0 {
+			err = NewError(EBadprop, fmt.Sprintf("'%s' property cannot be excluded", name))
+		}
+		return
+	}
+	p := DatasetProp(prop)
+	if typ != 0 {
+		return ValidateProperty(p, value, typ)
+	}
+	if err = ValidateProperty(p, value, DatasetTypeFilesystem); err != nil {
+		if ValidateProperty(p, value, DatasetTypeVolume) == nil {
+			err = nil
+		}
 	}
 	return
 }
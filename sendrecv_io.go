@@ -0,0 +1,67 @@
+package zfs
+
+import (
+	"io"
+	"os"
+)
+
+// withWriteFd - run fn with file descriptor writing to w. *os.File is passed
+// to fn directly, other writers are fed through a pipe by a goroutine. If w
+// fails (e.g. consumer stopped reading) read end of the pipe is closed so
+// libzfs gets EPIPE instead of blocking forever, and error of w is returned
+// since it is the root cause.
+func withWriteFd(w io.Writer, fn func(fd uintptr) error) (err error) {
+	if f, ok := w.(*os.File); ok {
+		return fn(f.Fd())
+	}
+	var pr, pw *os.File
+	if pr, pw, err = os.Pipe(); err != nil {
+		return
+	}
+	copyErr := make(chan error, 1)
+	go func() {
+		_, cerr := io.Copy(w, pr)
+		pr.Close()
+		copyErr <- cerr
+	}()
+	err = fn(pw.Fd())
+	pw.Close() // EOF for copying goroutine
+	if cerr := <-copyErr; cerr != nil {
+		err = cerr
+	}
+	return
+}
+
+// withReadFd - run fn with file descriptor reading from r. *os.File is passed
+// to fn directly, other readers are fed through a pipe by a goroutine. When
+// fn returns read end of the pipe is closed, so goroutine stops at its next
+// write even if libzfs did not consume whole input. Error of r is returned
+// if fn failed since premature end of stream is reported by libzfs only as
+// incomplete stream.
+func withReadFd(r io.Reader, fn func(fd uintptr) error) (err error) {
+	if f, ok := r.(*os.File); ok {
+		return fn(f.Fd())
+	}
+	var pr, pw *os.File
+	if pr, pw, err = os.Pipe(); err != nil {
+		return
+	}
+	copyErr := make(chan error, 1)
+	go func() {
+		_, cerr := io.Copy(pw, r)
+		// report error before EOF is seen by libzfs
+		copyErr <- cerr
+		pw.Close()
+	}()
+	err = fn(pr.Fd())
+	pr.Close()
+	// don't wait for r, it may block in Read after fn is done
+	select {
+	case cerr := <-copyErr:
+		if err != nil && cerr != nil {
+			err = cerr
+		}
+	default:
+	}
+	return
+}
@@ -0,0 +1,109 @@
+package zfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n <= 0 {
+		return 0, errors.New("consumer gone")
+	}
+	w.n--
+	return len(p), nil
+}
+
+type failingReader struct {
+	r io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (n int, err error) {
+	if n, err = r.r.Read(p); err == io.EOF {
+		err = errors.New("connection reset")
+	}
+	return
+}
+
+func writeAll(fd uintptr, data []byte) error {
+	for len(data) > 0 {
+		n, err := syscall.Write(int(fd), data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func readAll(fd uintptr) (data []byte, err error) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := syscall.Read(int(fd), buf)
+		if err != nil || n == 0 {
+			return data, err
+		}
+		data = append(data, buf[:n]...)
+	}
+}
+
+func TestWithWriteFd(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	var buf bytes.Buffer
+	if err := withWriteFd(&buf, func(fd uintptr) error {
+		return writeAll(fd, data)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("written %d bytes, got %d", len(data), buf.Len())
+	}
+
+	// consumer stops reading, writer must not block forever
+	err := withWriteFd(&failingWriter{n: 1}, func(fd uintptr) error {
+		return writeAll(fd, data)
+	})
+	if err == nil || err.Error() != "consumer gone" {
+		t.Fatalf("expected consumer error, got %v", err)
+	}
+}
+
+func TestWithReadFd(t *testing.T) {
+	data := strings.Repeat("0123456789abcdef", 64*1024)
+	var got []byte
+	if err := withReadFd(strings.NewReader(data), func(fd uintptr) (err error) {
+		got, err = readAll(fd)
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Fatalf("read %d bytes, expected %d", len(got), len(data))
+	}
+
+	// fn stops reading early, must not deadlock
+	if err := withReadFd(strings.NewReader(data), func(fd uintptr) error {
+		_, err := syscall.Read(int(fd), make([]byte, 1))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// error of reader is reported instead of incomplete stream
+	err := withReadFd(&failingReader{strings.NewReader("short")}, func(fd uintptr) error {
+		if _, err := readAll(fd); err != nil {
+			return err
+		}
+		return errors.New("incomplete stream")
+	})
+	if err == nil || err.Error() != "connection reset" {
+		t.Fatalf("expected reader error, got %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package sendstream
+
+import "encoding/binary"
+
+// fletcher4 - incremental fletcher-4 over 32-bit words in stream byte order,
+// same as fletcher_4_incremental_native/byteswap in zfs
+type fletcher4 struct {
+	a, b, c, d uint64
+}
+
+func (f *fletcher4) update(order binary.ByteOrder, buf []byte) {
+	a, b, c, d := f.a, f.b, f.c, f.d
+	for i := 0; i+4 <= len(buf); i += 4 {
+		a += uint64(order.Uint32(buf[i:]))
+		b += a
+		c += b
+		d += c
+	}
+	f.a, f.b, f.c, f.d = a, b, c, d
+}
+
+func (f *fletcher4) sum() Checksum {
+	return Checksum{f.a, f.b, f.c, f.d}
+}
+
+func (f *fletcher4) reset() {
+	*f = fletcher4{}
+}
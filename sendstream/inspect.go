@@ -0,0 +1,81 @@
+package sendstream
+
+import "io"
+
+// Substream - one dataset snapshot stream (BEGIN to END) of send stream
+type Substream struct {
+	Begin
+	// Offset of BEGIN record in stream
+	Offset int64
+	// Size of substream in bytes, records and payloads
+	Size int64
+	// Records count by type
+	Records map[RecordType]uint64
+	// PayloadBytes in substream, without record headers
+	PayloadBytes uint64
+	// Checksum of substream as stored in its END record
+	Checksum Checksum
+}
+
+// Summary - content of send stream
+type Summary struct {
+	// Compound is set for replication (-R) stream, which begins with
+	// header describing sent datasets
+	Compound bool
+	// Header is compound stream BEGIN record, nil for other streams
+	Header *Begin
+	// HeaderPayload is packed nvlist of compound header
+	HeaderPayload []byte
+	Streams       []Substream
+	// Size of whole stream in bytes
+	Size int64
+}
+
+// Inspect reads send stream from r to its end, verifying record
+// checksums, and returns description of substreams found. r is not read
+// past final END record.
+func Inspect(r io.Reader) (sum *Summary, err error) {
+	var rec *Record
+	var cur *Substream
+	reader := NewReader(r)
+	sum = &Summary{}
+	for {
+		start := reader.Offset()
+		if rec, err = reader.Next(); err != nil {
+			if err == io.EOF {
+				err = nil
+				sum.Size = reader.Offset()
+			}
+			return
+		}
+		if rec.Type == RecordBegin && rec.Begin.HeaderType == HeaderCompound {
+			sum.Compound = true
+			sum.Header = rec.Begin
+			sum.HeaderPayload = append([]byte(nil), rec.Payload...)
+			continue
+		}
+		switch rec.Type {
+		case RecordBegin:
+			sum.Streams = append(sum.Streams, Substream{
+				Begin:   *rec.Begin,
+				Offset:  start,
+				Records: make(map[RecordType]uint64),
+			})
+			cur = &sum.Streams[len(sum.Streams)-1]
+		case RecordEnd:
+			if cur != nil {
+				cur.Checksum = rec.EndChecksum
+			}
+		}
+		if cur == nil {
+			// END of compound header or final END of package
+			continue
+		}
+		cur.Records[rec.Type]++
+		cur.PayloadBytes += uint64(len(rec.Payload))
+		cur.Size = reader.Offset() - cur.Offset
+		if rec.Type == RecordEnd {
+			cur = nil
+		}
+	}
+}
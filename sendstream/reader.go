@@ -0,0 +1,230 @@
+package sendstream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxPayload is largest record payload Reader accepts
+const MaxPayload = 1 << 30
+
+// Errors
+var (
+	ErrBadMagic    = errors.New("sendstream: stream does not begin with BEGIN record")
+	ErrEmptyStream = errors.New("sendstream: empty stream")
+	ErrTruncated   = errors.New("sendstream: truncated stream")
+)
+
+const (
+	errRecordOrder  = "sendstream: unexpected %s record at offset %d"
+	errPayloadLimit = "sendstream: %s record at offset %d has payload of %d bytes"
+)
+
+// ChecksumError - record or stream checksum does not match data
+type ChecksumError struct {
+	// Offset of record in stream
+	Offset   int64
+	Type     RecordType
+	Expected Checksum
+	Actual   Checksum
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("sendstream: %s record at offset %d: checksum mismatch, expected %s got %s",
+		e.Type, e.Offset, e.Expected, e.Actual)
+}
+
+// GUIDError - END record does not close stream it belongs to
+type GUIDError struct {
+	Offset   int64
+	Expected uint64
+	Actual   uint64
+}
+
+func (e *GUIDError) Error() string {
+	return fmt.Sprintf("sendstream: END record at offset %d: toguid %x does not match BEGIN toguid %x",
+		e.Offset, e.Actual, e.Expected)
+}
+
+type readerState int
+
+const (
+	stateStart readerState = iota
+	stateInStream
+	stateAfterEnd
+	stateDone
+)
+
+// Reader - reads records of send stream one by one, verifying checksums.
+// Plain, incremental (-i, -I) and replication (-R) streams are accepted,
+// Next returns io.EOF after END of single stream, or after final END of
+// stream with compound header.
+type Reader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	cksum    fletcher4
+	state    readerState
+	offset   int64
+	toguid   uint64
+	rec      Record
+	buf      []byte
+	compound bool
+}
+
+// NewReader - reader of send stream from r. Reader does not read past final
+// END record of stream.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// ByteOrder of stream being read, nil before first record
+func (r *Reader) ByteOrder() binary.ByteOrder {
+	return r.order
+}
+
+// Offset - number of bytes consumed from stream
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+// Compound reports whether stream begun with compound (-R) header
+func (r *Reader) Compound() bool {
+	return r.compound
+}
+
+// Next record of stream. Returned record and its payload are valid until
+// next call.
+func (r *Reader) Next() (rec *Record, err error) {
+	if r.state == stateDone {
+		err = io.EOF
+		return
+	}
+	rec = &r.rec
+	*rec = Record{}
+	var n int
+	if n, err = io.ReadFull(r.r, rec.Header[:]); err != nil {
+		rec = nil
+		if n == 0 && err == io.EOF {
+			switch r.state {
+			case stateStart:
+				err = ErrEmptyStream
+			case stateAfterEnd:
+				r.state = stateDone
+			default:
+				err = ErrTruncated
+			}
+		} else if err == io.ErrUnexpectedEOF {
+			err = ErrTruncated
+		}
+		return
+	}
+	start := r.offset
+	r.offset += recordSize
+	if r.state != stateInStream {
+		if order := beginOrder(rec.Header[:]); order != nil {
+			r.order = order
+		} else if r.state == stateStart {
+			rec, err = nil, ErrBadMagic
+			return
+		}
+	}
+	prev := r.cksum.sum()
+	r.cksum.update(r.order, rec.Header[:recordChecksumOffset])
+	expected := r.cksum.sum()
+	r.cksum.update(r.order, rec.Header[recordChecksumOffset:])
+	payload := rec.decode(r.order)
+
+	if err = r.advance(rec, start); err != nil {
+		rec = nil
+		return
+	}
+	if rec.Type != RecordBegin && !rec.Checksum.IsZero() && rec.Checksum != expected {
+		err = &ChecksumError{Offset: start, Type: rec.Type, Expected: expected, Actual: rec.Checksum}
+		rec = nil
+		return
+	}
+	if rec.Type == RecordEnd {
+		if rec.EndChecksum != prev {
+			err = &ChecksumError{Offset: start, Type: rec.Type, Expected: prev, Actual: rec.EndChecksum}
+			rec = nil
+			return
+		}
+		r.cksum.reset()
+	}
+	if payload > MaxPayload {
+		err = fmt.Errorf(errPayloadLimit, rec.Type, start, payload)
+		rec = nil
+		return
+	}
+	if payload > 0 {
+		if uint64(cap(r.buf)) < payload {
+			r.buf = make([]byte, payload)
+		}
+		rec.Payload = r.buf[:payload]
+		if n, err = io.ReadFull(r.r, rec.Payload); err != nil {
+			r.offset += int64(n)
+			rec, err = nil, ErrTruncated
+			return
+		}
+		r.offset += int64(payload)
+		r.cksum.update(r.order, rec.Payload)
+	}
+	return
+}
+
+// advance state machine by record read at offset
+func (r *Reader) advance(rec *Record, offset int64) (err error) {
+	switch {
+	case rec.Type >= recordNumTypes:
+		err = fmt.Errorf("sendstream: unknown record type %d at offset %d", uint32(rec.Type), offset)
+	case rec.Type == RecordBegin:
+		if r.state == stateInStream {
+			err = fmt.Errorf(errRecordOrder, rec.Type, offset)
+			return
+		}
+		if rec.Begin.HeaderType == HeaderCompound {
+			if r.state != stateStart {
+				err = fmt.Errorf(errRecordOrder, rec.Type, offset)
+				return
+			}
+			r.compound = true
+		}
+		r.toguid = rec.Begin.ToGUID
+		r.state = stateInStream
+	case rec.Type == RecordEnd:
+		switch r.state {
+		case stateInStream:
+			if rec.ToGUID != r.toguid {
+				err = &GUIDError{Offset: offset, Expected: r.toguid, Actual: rec.ToGUID}
+				return
+			}
+			r.state = stateAfterEnd
+			if !r.compound {
+				// stream without compound header has single substream
+				r.state = stateDone
+			}
+		case stateAfterEnd:
+			// final END record of multi-stream package
+			r.state = stateDone
+		default:
+			err = fmt.Errorf(errRecordOrder, rec.Type, offset)
+		}
+	case r.state != stateInStream:
+		err = fmt.Errorf(errRecordOrder, rec.Type, offset)
+	}
+	return
+}
+
+// beginOrder - byte order of BEGIN record by its magic, nil if record is not
+// BEGIN in either order
+func beginOrder(hdr []byte) binary.ByteOrder {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		if RecordType(order.Uint32(hdr)) == RecordBegin &&
+			order.Uint64(hdr[recordUnionOffset:]) == beginMagic {
+			return order
+		}
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package sendstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// streamWriter produces records the way dump_record does in zfs
+type streamWriter struct {
+	buf   bytes.Buffer
+	order binary.ByteOrder
+	cksum fletcher4
+}
+
+func (w *streamWriter) record(typ RecordType, fill func(u []byte), payload []byte) {
+	var hdr [recordSize]byte
+	w.order.PutUint32(hdr[0:], uint32(typ))
+	if typ == RecordBegin {
+		w.order.PutUint32(hdr[4:], uint32(len(payload)))
+	}
+	if fill != nil {
+		fill(hdr[recordUnionOffset:])
+	}
+	w.cksum.update(w.order, hdr[:recordChecksumOffset])
+	if typ != RecordBegin {
+		for i, v := range w.cksum.sum() {
+			w.order.PutUint64(hdr[recordChecksumOffset+8*i:], v)
+		}
+	}
+	w.cksum.update(w.order, hdr[recordChecksumOffset:])
+	w.buf.Write(hdr[:])
+	w.cksum.update(w.order, payload)
+	w.buf.Write(payload)
+}
+
+func (w *streamWriter) begin(hdrtype HeaderType, features Features, name string, fromguid, toguid uint64, payload []byte) {
+	w.record(RecordBegin, func(u []byte) {
+		w.order.PutUint64(u[0:], beginMagic)
+		w.order.PutUint64(u[8:], uint64(hdrtype)|uint64(features)<<2)
+		w.order.PutUint64(u[16:], 1500000000)
+		w.order.PutUint32(u[24:], 2)
+		w.order.PutUint64(u[32:], toguid)
+		w.order.PutUint64(u[40:], fromguid)
+		copy(u[48:], name)
+	}, payload)
+}
+
+func (w *streamWriter) end(toguid uint64) {
+	sum := w.cksum.sum()
+	w.record(RecordEnd, func(u []byte) {
+		for i, v := range sum {
+			w.order.PutUint64(u[8*i:], v)
+		}
+		w.order.PutUint64(u[32:], toguid)
+	}, nil)
+	w.cksum.reset()
+}
+
+// body writes one record of each data carrying type
+func (w *streamWriter) body(toguid uint64) {
+	w.record(RecordObjectRange, func(u []byte) {
+		w.order.PutUint64(u[0:], 0)
+		w.order.PutUint64(u[8:], 32)
+		w.order.PutUint64(u[16:], toguid)
+	}, nil)
+	w.record(RecordObject, func(u []byte) {
+		w.order.PutUint64(u[0:], 2)
+		w.order.PutUint32(u[16:], 4096)
+		w.order.PutUint32(u[20:], 13)
+		w.order.PutUint64(u[32:], toguid)
+	}, make([]byte, 16))
+	w.record(RecordWrite, func(u []byte) {
+		w.order.PutUint64(u[0:], 2)
+		w.order.PutUint64(u[24:], 4096)
+		w.order.PutUint64(u[32:], toguid)
+	}, bytes.Repeat([]byte{0xab}, 4096))
+	w.record(RecordWrite, func(u []byte) {
+		w.order.PutUint64(u[0:], 2)
+		w.order.PutUint64(u[16:], 4096)
+		w.order.PutUint64(u[24:], 4096)
+		w.order.PutUint64(u[32:], toguid)
+		u[42] = 15
+		w.order.PutUint64(u[88:], 512)
+	}, make([]byte, 512))
+	w.record(RecordWriteEmbedded, func(u []byte) {
+		w.order.PutUint64(u[0:], 2)
+		w.order.PutUint64(u[8:], 8192)
+		w.order.PutUint64(u[16:], 4096)
+		w.order.PutUint64(u[24:], toguid)
+		w.order.PutUint32(u[40:], 4096)
+		w.order.PutUint32(u[44:], 37)
+	}, make([]byte, 40))
+	w.record(RecordSpill, func(u []byte) {
+		w.order.PutUint64(u[0:], 2)
+		w.order.PutUint64(u[8:], 512)
+		w.order.PutUint64(u[16:], toguid)
+	}, make([]byte, 512))
+	w.record(RecordFree, func(u []byte) {
+		w.order.PutUint64(u[0:], 2)
+		w.order.PutUint64(u[8:], 12288)
+		w.order.PutUint64(u[16:], ^uint64(0))
+		w.order.PutUint64(u[24:], toguid)
+	}, nil)
+	w.record(RecordFreeObjects, func(u []byte) {
+		w.order.PutUint64(u[0:], 3)
+		w.order.PutUint64(u[8:], 29)
+		w.order.PutUint64(u[16:], toguid)
+	}, nil)
+}
+
+func plainStream(order binary.ByteOrder) []byte {
+	w := &streamWriter{order: order}
+	w.begin(HeaderSubstream, FeatureLargeBlocks|FeatureEmbedData, "pool/fs@snap1", 0, 0x1111, nil)
+	w.body(0x1111)
+	w.end(0x1111)
+	return w.buf.Bytes()
+}
+
+func compoundStream() []byte {
+	w := &streamWriter{order: binary.LittleEndian}
+	w.begin(HeaderCompound, FeatureLargeBlocks, "pool/fs@snap2", 0, 0, make([]byte, 64))
+	// libzfs writes END of compound header raw, without record checksum
+	var hdr [recordSize]byte
+	w.order.PutUint32(hdr[0:], uint32(RecordEnd))
+	for i, v := range w.cksum.sum() {
+		w.order.PutUint64(hdr[recordUnionOffset+8*i:], v)
+	}
+	w.buf.Write(hdr[:])
+	w.cksum.reset()
+
+	w.begin(HeaderSubstream, FeatureLargeBlocks, "pool/fs@snap1", 0, 0x1111, nil)
+	w.body(0x1111)
+	w.end(0x1111)
+	w.begin(HeaderSubstream, FeatureLargeBlocks, "pool/fs@snap2", 0x1111, 0x2222, nil)
+	w.body(0x2222)
+	w.end(0x2222)
+
+	// final END record
+	hdr = [recordSize]byte{}
+	w.order.PutUint32(hdr[0:], uint32(RecordEnd))
+	w.buf.Write(hdr[:])
+	return w.buf.Bytes()
+}
+
+func TestReadPlainStream(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		stream := plainStream(order)
+		r := NewReader(bytes.NewReader(stream))
+		var types []RecordType
+		var payload int
+		for {
+			rec, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Error(order, err)
+				return
+			}
+			if rec.Type == RecordBegin {
+				b := rec.Begin
+				if b.ToName != "pool/fs@snap1" || b.ToGUID != 0x1111 ||
+					b.HeaderType != HeaderSubstream ||
+					b.Features != FeatureLargeBlocks|FeatureEmbedData {
+					t.Errorf("%v: unexpected BEGIN %+v", order, b)
+				}
+			}
+			types = append(types, rec.Type)
+			payload += len(rec.Payload)
+		}
+		if r.ByteOrder() != order {
+			t.Errorf("byte order %v, expected %v", r.ByteOrder(), order)
+		}
+		if len(types) != 10 || types[0] != RecordBegin || types[9] != RecordEnd {
+			t.Errorf("%v: unexpected records %v", order, types)
+		}
+		if want := 16 + 4096 + 512 + 40 + 512; payload != want {
+			t.Errorf("%v: payload %d bytes, expected %d", order, payload, want)
+		}
+		if r.Offset() != int64(len(stream)) {
+			t.Errorf("%v: read %d of %d bytes", order, r.Offset(), len(stream))
+		}
+	}
+}
+
+func TestInspectCompound(t *testing.T) {
+	stream := compoundStream()
+	// trailing data after final END must stay unread
+	src := bytes.NewReader(append(append([]byte(nil), stream...), "trailer"...))
+	sum, err := Inspect(src)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !sum.Compound || sum.Header == nil || len(sum.HeaderPayload) != 64 {
+		t.Errorf("compound header not reported: %+v", sum)
+	}
+	if sum.Size != int64(len(stream)) || src.Len() != len("trailer") {
+		t.Errorf("stream size %d, expected %d, %d bytes left", sum.Size, len(stream), src.Len())
+	}
+	if len(sum.Streams) != 2 {
+		t.Errorf("%d substreams, expected 2", len(sum.Streams))
+		return
+	}
+	s := sum.Streams[1]
+	if s.ToName != "pool/fs@snap2" || s.FromGUID != 0x1111 || s.ToGUID != 0x2222 {
+		t.Errorf("unexpected substream %+v", s.Begin)
+	}
+	if s.Records[RecordWrite] != 2 || s.Records[RecordEnd] != 1 || s.Checksum.IsZero() {
+		t.Errorf("unexpected substream records %v checksum %v", s.Records, s.Checksum)
+	}
+	if s.Offset+s.Size != sum.Size-recordSize {
+		t.Errorf("substream at %d of %d bytes does not end before final END", s.Offset, s.Size)
+	}
+}
+
+func TestReadCorruptStream(t *testing.T) {
+	stream := plainStream(binary.LittleEndian)
+	read := func(b []byte) (err error) {
+		_, err = Inspect(bytes.NewReader(b))
+		return
+	}
+	// flip a byte of WRITE payload, caught by checksum of next record
+	bad := append([]byte(nil), stream...)
+	bad[4*recordSize+16+100] ^= 1
+	if _, ok := read(bad).(*ChecksumError); !ok {
+		t.Error("corrupted payload not detected")
+	}
+	// flip a byte in last record header before its checksum
+	bad = append([]byte(nil), stream...)
+	bad[len(bad)-recordSize+recordUnionOffset+32] ^= 1
+	if err := read(bad); err == nil {
+		t.Error("corrupted END record not detected")
+	}
+	if err := read(stream[:len(stream)-1]); err != ErrTruncated {
+		t.Errorf("truncated stream: %v", err)
+	}
+	if err := read(nil); err != ErrEmptyStream {
+		t.Errorf("empty stream: %v", err)
+	}
+	if err := read(stream[recordSize:]); err != ErrBadMagic {
+		t.Errorf("stream without BEGIN: %v", err)
+	}
+}
+
+// testdata/incremental-le.zsend is incremental stream of one WRITE and FREE
+// laid out by offsets of dmu_replay_record_t in zfs_ioctl.h and checksummed
+// the way dump_record does, without using code of this package
+func TestReadFixture(t *testing.T) {
+	stream, err := ioutil.ReadFile("testdata/incremental-le.zsend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// data following plain stream must stay unread
+	src := bytes.NewReader(append(append([]byte(nil), stream...), make([]byte, recordSize)...))
+	r := NewReader(src)
+	var recs []Record
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, *rec)
+	}
+	if r.Offset() != 2264 || src.Len() != recordSize {
+		t.Errorf("read %d bytes, %d bytes left", r.Offset(), src.Len())
+	}
+	if len(recs) != 5 {
+		t.Fatalf("%d records, expected 5", len(recs))
+	}
+	b := recs[0].Begin
+	if b == nil || b.HeaderType != HeaderSubstream || b.Features != FeatureEmbedData|FeatureLZ4|FeatureLargeBlocks ||
+		b.CreationTime.Unix() != 1600000000 || b.ObjsetType != 2 || b.Flags != BeginFlagFreeRecords ||
+		b.ToGUID != 0x8a6b3c2d1e0f4a5b || b.FromGUID != 0x1122334455667788 || b.ToName != "tank/fs@snap2" {
+		t.Errorf("unexpected BEGIN %+v", b)
+	}
+	if o := recs[1]; o.Type != RecordObject || o.Object != 2 || o.Length != 131072 || len(o.Payload) != 192 {
+		t.Errorf("unexpected OBJECT %v object %d length %d payload %d", o.Type, o.Object, o.Length, len(o.Payload))
+	}
+	if w := recs[2]; w.Type != RecordWrite || w.Object != 2 || w.Offset != 0 || w.Length != 512 ||
+		!bytes.HasPrefix(w.Payload, []byte("hello, send stream\n")) {
+		t.Errorf("unexpected WRITE %v object %d offset %d length %d", w.Type, w.Object, w.Offset, w.Length)
+	}
+	if f := recs[3]; f.Type != RecordFree || f.Object != 2 || f.Offset != 512 || f.Length != ^uint64(0) {
+		t.Errorf("unexpected FREE %v object %d offset %d length %d", f.Type, f.Object, f.Offset, f.Length)
+	}
+	end := recs[4]
+	if expected := (Checksum{0x21173a5737, 0x2270f2c3e700, 0x15f8d2aa68d33c, 0xa0e8563d091ca7a}); end.Type != RecordEnd ||
+		end.EndChecksum != expected || end.ToGUID != 0x8a6b3c2d1e0f4a5b {
+		t.Errorf("unexpected END %v checksum %v toguid %x", end.Type, end.EndChecksum, end.ToGUID)
+	}
+}
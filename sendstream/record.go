@@ -0,0 +1,262 @@
+// Package sendstream reads ZFS send streams (dmu_replay_record_t records)
+// without libzfs, so streams can be verified and indexed without a pool.
+package sendstream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RecordType - drr_type of replay record
+type RecordType uint32
+
+// Record types
+const (
+	RecordBegin RecordType = iota
+	RecordObject
+	RecordFreeObjects
+	RecordWrite
+	RecordFree
+	RecordEnd
+	RecordWriteByref
+	RecordSpill
+	RecordWriteEmbedded
+	RecordObjectRange
+	RecordRedact
+	recordNumTypes
+)
+
+var recordTypeNames = [...]string{
+	"BEGIN", "OBJECT", "FREEOBJECTS", "WRITE", "FREE", "END",
+	"WRITE_BYREF", "SPILL", "WRITE_EMBEDDED", "OBJECT_RANGE", "REDACT",
+}
+
+func (t RecordType) String() string {
+	if t < recordNumTypes {
+		return recordTypeNames[t]
+	}
+	return fmt.Sprintf("RecordType(%d)", uint32(t))
+}
+
+// HeaderType - stream header type from BEGIN versioninfo
+type HeaderType uint8
+
+// Header types
+const (
+	HeaderSubstream HeaderType = 1
+	HeaderCompound  HeaderType = 2
+)
+
+// Features - DMU_BACKUP_FEATURE_* flags from BEGIN versioninfo
+type Features uint32
+
+// Stream features
+const (
+	FeatureDedup               Features = 1 << 0
+	FeatureDedupProps          Features = 1 << 1
+	FeatureSASpill             Features = 1 << 2
+	FeatureEmbedData           Features = 1 << 16
+	FeatureLZ4                 Features = 1 << 17
+	FeatureLargeBlocks         Features = 1 << 19
+	FeatureResuming            Features = 1 << 20
+	FeatureRedacted            Features = 1 << 21
+	FeatureCompressed          Features = 1 << 22
+	FeatureLargeDnode          Features = 1 << 23
+	FeatureRaw                 Features = 1 << 24
+	FeatureZstd                Features = 1 << 25
+	FeatureHolds               Features = 1 << 26
+	FeatureSwitchToLargeBlocks Features = 1 << 27
+)
+
+var featureNames = []struct {
+	f    Features
+	name string
+}{
+	{FeatureDedup, "dedup"},
+	{FeatureDedupProps, "dedupprops"},
+	{FeatureSASpill, "sa_spill"},
+	{FeatureEmbedData, "embed_data"},
+	{FeatureLZ4, "lz4"},
+	{FeatureLargeBlocks, "large_blocks"},
+	{FeatureResuming, "resuming"},
+	{FeatureRedacted, "redacted"},
+	{FeatureCompressed, "compressed"},
+	{FeatureLargeDnode, "large_dnode"},
+	{FeatureRaw, "raw"},
+	{FeatureZstd, "zstd"},
+	{FeatureHolds, "holds"},
+	{FeatureSwitchToLargeBlocks, "switch_to_large_blocks"},
+}
+
+// Names of set features, unknown bits are reported as hex
+func (f Features) Names() (names []string) {
+	rest := f
+	for _, fn := range featureNames {
+		if f&fn.f != 0 {
+			names = append(names, fn.name)
+			rest &^= fn.f
+		}
+	}
+	if rest != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint32(rest)))
+	}
+	return
+}
+
+func (f Features) String() string {
+	return strings.Join(f.Names(), ",")
+}
+
+// BEGIN record flags (drr_flags)
+const (
+	BeginFlagClone       uint32 = 1 << 0
+	BeginFlagCIData      uint32 = 1 << 1
+	BeginFlagFreeRecords uint32 = 1 << 2
+	BeginFlagSpillBlock  uint32 = 1 << 3
+)
+
+// dmu_replay_record_t layout
+const (
+	beginMagic           uint64 = 0x2F5bacbac
+	recordSize                  = 312
+	recordChecksumOffset        = recordSize - 32
+	recordUnionOffset           = 8
+	beginToNameLen              = 256
+	payloadAlign                = 8
+)
+
+// Checksum - fletcher-4 checksum (zio_cksum_t)
+type Checksum [4]uint64
+
+// IsZero reports unset checksum
+func (c Checksum) IsZero() bool {
+	return c == Checksum{}
+}
+
+func (c Checksum) String() string {
+	return fmt.Sprintf("%x/%x/%x/%x", c[0], c[1], c[2], c[3])
+}
+
+// Begin - decoded BEGIN record
+type Begin struct {
+	VersionInfo  uint64
+	HeaderType   HeaderType
+	Features     Features
+	CreationTime time.Time
+	// ObjsetType is dmu_objset_type_t of sent dataset (2 filesystem, 3 volume)
+	ObjsetType uint32
+	Flags      uint32
+	ToGUID     uint64
+	FromGUID   uint64
+	ToName     string
+}
+
+// Record - one replay record. Fields not used by the record type are zero.
+type Record struct {
+	Type RecordType
+	// PayloadLen as stored in record header, meaningful for BEGIN only
+	PayloadLen uint32
+	// Begin is set for BEGIN records
+	Begin *Begin
+	// Object, or first object for FREEOBJECTS and OBJECT_RANGE
+	Object uint64
+	// Offset in object, or number of objects for FREEOBJECTS and
+	// OBJECT_RANGE
+	Offset uint64
+	// Length of data described by record (logical size for writes)
+	Length uint64
+	ToGUID uint64
+	// EndChecksum is stream checksum stored in END record
+	EndChecksum Checksum
+	// Checksum is running checksum stored in record header, zero for
+	// BEGIN and for records written without one
+	Checksum Checksum
+	// Header is raw record as read from stream
+	Header [recordSize]byte
+	// Payload following record, valid until next call to Reader.Next
+	Payload []byte
+}
+
+func (rec *Record) decode(order binary.ByteOrder) (payload uint64) {
+	h := rec.Header[:]
+	u := h[recordUnionOffset:]
+	u64 := func(off int) uint64 { return order.Uint64(u[off:]) }
+	u32 := func(off int) uint32 { return order.Uint32(u[off:]) }
+	rec.Type = RecordType(order.Uint32(h))
+	rec.PayloadLen = order.Uint32(h[4:])
+	for i := range rec.Checksum {
+		rec.Checksum[i] = order.Uint64(h[recordChecksumOffset+8*i:])
+	}
+	switch rec.Type {
+	case RecordBegin:
+		vi := u64(8)
+		name := u[48 : 48+beginToNameLen]
+		if i := strings.IndexByte(string(name), 0); i >= 0 {
+			name = name[:i]
+		}
+		rec.Begin = &Begin{
+			VersionInfo:  vi,
+			HeaderType:   HeaderType(vi & 0x3),
+			Features:     Features((vi >> 2) & 0x3fffffff),
+			CreationTime: time.Unix(int64(u64(16)), 0),
+			ObjsetType:   u32(24),
+			Flags:        u32(28),
+			ToGUID:       u64(32),
+			FromGUID:     u64(40),
+			ToName:       string(name),
+		}
+		rec.ToGUID = rec.Begin.ToGUID
+		payload = uint64(rec.PayloadLen)
+	case RecordObject:
+		rec.Object = u64(0)
+		rec.Length = uint64(u32(16))
+		rec.ToGUID = u64(32)
+		if raw := u32(28); raw != 0 {
+			payload = uint64(raw)
+		} else {
+			payload = roundup8(uint64(u32(20)))
+		}
+	case RecordFreeObjects:
+		rec.Object, rec.Offset, rec.ToGUID = u64(0), u64(8), u64(16)
+	case RecordWrite:
+		rec.Object, rec.Offset, rec.Length = u64(0), u64(16), u64(24)
+		rec.ToGUID = u64(32)
+		payload = rec.Length
+		if u[42] != 0 {
+			payload = u64(88)
+		}
+	case RecordFree:
+		rec.Object, rec.Offset, rec.Length = u64(0), u64(8), u64(16)
+		rec.ToGUID = u64(24)
+	case RecordEnd:
+		for i := range rec.EndChecksum {
+			rec.EndChecksum[i] = u64(8 * i)
+		}
+		rec.ToGUID = u64(32)
+	case RecordWriteByref:
+		rec.Object, rec.Offset, rec.Length = u64(0), u64(8), u64(16)
+		rec.ToGUID = u64(24)
+	case RecordSpill:
+		rec.Object, rec.Length, rec.ToGUID = u64(0), u64(8), u64(16)
+		payload = rec.Length
+		if cs := u64(32); cs != 0 {
+			payload = cs
+		}
+	case RecordWriteEmbedded:
+		rec.Object, rec.Offset, rec.Length = u64(0), u64(8), u64(16)
+		rec.ToGUID = u64(24)
+		payload = roundup8(uint64(u32(44)))
+	case RecordObjectRange:
+		rec.Object, rec.Offset, rec.ToGUID = u64(0), u64(8), u64(16)
+	case RecordRedact:
+		rec.Object, rec.Offset, rec.Length = u64(0), u64(8), u64(16)
+		rec.ToGUID = u64(24)
+	}
+	return
+}
+
+func roundup8(n uint64) uint64 {
+	return (n + payloadAlign - 1) &^ (payloadAlign - 1)
+}
@@ -48,3 +48,19 @@ func (list clonesCreateDesc) Swap(i, j int) {
 func (list clonesCreateDesc) Len() int {
 	return len(list)
 }
+
+type snapshotsCreateAsc []Dataset
+
+func (list snapshotsCreateAsc) Less(i, j int) bool {
+	txgi, _ := strconv.ParseUint(list[i].Properties[DatasetPropCreateTXG].Value, 10, 64)
+	txgj, _ := strconv.ParseUint(list[j].Properties[DatasetPropCreateTXG].Value, 10, 64)
+	return txgi < txgj
+}
+
+func (list snapshotsCreateAsc) Swap(i, j int) {
+	list[i], list[j] = list[j], list[i]
+}
+
+func (list snapshotsCreateAsc) Len() int {
+	return len(list)
+}
@@ -2,7 +2,9 @@
  * using libzfs from go language, make go code shorter and more readable.
  */
 
+#include <errno.h>
 #include <libzfs.h>
+#include <libzfs_core.h>
 #include <memory.h>
 #include <string.h>
 #include <stdio.h>
@@ -95,6 +97,116 @@ int dataset_create(const char *path, zfs_type_t type, nvlist_ptr props) {
 	return zfs_create(libzfs_get_handle(), path, type, props);
 }
 
+/*
+ * Add default refreservation (or reservation on old pools) for non sparse
+ * volume the same way 'zfs create -V' does, unless set explicitly.
+ */
+static int volume_add_reservation(const char *path, nvlist_t *props) {
+	char poolname[ZFS_MAX_DATASET_NAME_LEN];
+	char msg[1024];
+	char *strval, *p;
+	uint64_t volsize;
+	zpool_handle_t *zph;
+	nvlist_t *real_props;
+	zfs_prop_t resv_prop;
+
+	if (nvlist_lookup_string(props, zfs_prop_to_name(ZFS_PROP_VOLSIZE), &strval) != 0) {
+		/* zfs_create reports missing volsize */
+		return (0);
+	}
+	if (zfs_nicestrtonum(libzfs_get_handle(), strval, &volsize) != 0) {
+		return (-1);
+	}
+	(void) strncpy(poolname, path, sizeof (poolname) - 1);
+	poolname[sizeof (poolname) - 1] = '\0';
+	if ((p = strchr(poolname, '/')) != NULL) {
+		*p = '\0';
+	}
+	if ((zph = zpool_open(libzfs_get_handle(), poolname)) == NULL) {
+		return (-1);
+	}
+	if (zpool_get_prop_int(zph, ZPOOL_PROP_VERSION, NULL) >= SPA_VERSION_REFRESERVATION) {
+		resv_prop = ZFS_PROP_REFRESERVATION;
+	} else {
+		resv_prop = ZFS_PROP_RESERVATION;
+	}
+	(void) snprintf(msg, sizeof (msg), "cannot create '%s'", path);
+#if LIBZFS_VERSION_MINOR == 7
+	real_props = zfs_valid_proplist(libzfs_get_handle(), ZFS_TYPE_VOLUME,
+		props, 0, NULL, zph, msg);
+#else
+	real_props = zfs_valid_proplist(libzfs_get_handle(), ZFS_TYPE_VOLUME,
+		props, 0, NULL, zph, B_TRUE, msg);
+#endif
+	if (real_props == NULL) {
+		zpool_close(zph);
+		return (-1);
+	}
+#if LIBZFS_VERSION_MAJOR >= 2
+	volsize = zvol_volsize_to_reservation(zph, volsize, real_props);
+#else
+	volsize = zvol_volsize_to_reservation(volsize, real_props);
+#endif
+	nvlist_free(real_props);
+	zpool_close(zph);
+
+	if (nvlist_lookup_string(props, zfs_prop_to_name(resv_prop), &strval) != 0) {
+		return (nvlist_add_uint64(props, zfs_prop_to_name(resv_prop), volsize));
+	}
+	return (0);
+}
+
+/*
+ * New refreservation (or reservation on old pools) libzfs sets when volsize
+ * of volume zhp changes to volsize, computed the way zfs_add_synthetic_resv
+ * does. Reservation is adjusted only if it is the default one for current
+ * volsize, otherwise 0 is returned. Current reservation is stored to cur.
+ */
+uint64_t volume_resize_reservation(zfs_handle_t *zhp, uint64_t volsize, uint64_t *cur) {
+	zpool_handle_t *zph = zfs_get_pool_handle(zhp);
+	zfs_prop_t resv_prop;
+	nvlist_t *props;
+	uint64_t resv = 0;
+
+	if (zpool_get_prop_int(zph, ZPOOL_PROP_VERSION, NULL) >= SPA_VERSION_REFRESERVATION) {
+		resv_prop = ZFS_PROP_REFRESERVATION;
+	} else {
+		resv_prop = ZFS_PROP_RESERVATION;
+	}
+	*cur = zfs_prop_get_int(zhp, resv_prop);
+	props = fnvlist_alloc();
+	fnvlist_add_uint64(props, zfs_prop_to_name(ZFS_PROP_VOLBLOCKSIZE),
+		zfs_prop_get_int(zhp, ZFS_PROP_VOLBLOCKSIZE));
+#if LIBZFS_VERSION_MAJOR >= 2
+	if (zvol_volsize_to_reservation(zph, zfs_prop_get_int(zhp, ZFS_PROP_VOLSIZE), props) == *cur) {
+		resv = zvol_volsize_to_reservation(zph, volsize, props);
+	}
+#else
+	if (zvol_volsize_to_reservation(zfs_prop_get_int(zhp, ZFS_PROP_VOLSIZE), props) == *cur) {
+		resv = zvol_volsize_to_reservation(volsize, props);
+	}
+#endif
+	fnvlist_free(props);
+	return (resv);
+}
+
+int dataset_create_ex(const char *path, zfs_type_t type, nvlist_ptr props,
+	boolean_t parents, boolean_t sparse) {
+	if (parents && zfs_name_valid(path, type)) {
+		/* with parents existing dataset is not an error */
+		if (zfs_dataset_exists(libzfs_get_handle(), path, type)) {
+			return (0);
+		}
+		if (zfs_create_ancestors(libzfs_get_handle(), path) != 0) {
+			return (-1);
+		}
+	}
+	if (type == ZFS_TYPE_VOLUME && !sparse && volume_add_reservation(path, props) != 0) {
+		return (-1);
+	}
+	return zfs_create(libzfs_get_handle(), path, type, props);
+}
+
 int dataset_destroy(dataset_list_ptr dataset, boolean_t defer) {
 	return zfs_destroy(dataset->zh, defer);
 }
@@ -132,10 +244,155 @@ int dataset_user_prop_set(dataset_list_ptr dataset, const char *prop, const char
 	return zfs_prop_set(dataset->zh, prop, value);
 }
 
+int dataset_prop_valid(dataset_list_ptr dataset, nvlist_ptr props) {
+	nvlist_t *real_props;
+	char errbuf[1024];
+	zfs_handle_t *zhp = dataset->zh;
+	uint64_t zoned = zfs_prop_get_int(zhp, ZFS_PROP_ZONED);
+
+	(void) snprintf(errbuf, sizeof (errbuf),
+		"cannot set property for '%s'", zfs_get_name(zhp));
+#if LIBZFS_VERSION_MINOR == 7
+	real_props = zfs_valid_proplist(libzfs_get_handle(), zfs_get_type(zhp),
+		props, zoned, zhp, zfs_get_pool_handle(zhp), errbuf);
+#else
+	real_props = zfs_valid_proplist(libzfs_get_handle(), zfs_get_type(zhp),
+		props, zoned, zhp, zfs_get_pool_handle(zhp), B_FALSE, errbuf);
+#endif
+	if (real_props == NULL) {
+		return -1;
+	}
+	nvlist_free(real_props);
+	return 0;
+}
+
+/*
+ * Set props with ZFS_IOC_SET_PROP the way zfs_prop_set_list does, but keep
+ * errlist of the ioctl mapping every property kernel failed to set to its
+ * errno. Properties which need libzfs to unmount, reshare or remount the
+ * dataset, or to adjust volume reservation, are set by zfs_prop_set_list
+ * and errlist is left NULL. Returns -1 on libzfs error, errno of the ioctl
+ * or 0.
+ */
+int dataset_prop_set_list(dataset_list_ptr dataset, nvlist_ptr props,
+	nvlist_ptr *errlist) {
+	nvlist_t *real_props;
+	nvpair_t *elem = NULL;
+	char errbuf[1024];
+	zfs_handle_t *zhp = dataset->zh;
+	uint64_t zoned = zfs_prop_get_int(zhp, ZFS_PROP_ZONED);
+	struct zfs_cmd zc;
+	char *packed, *dst;
+	size_t size;
+	size_t dstsize = 64 * 1024;
+	int rc = 0;
+
+	*errlist = NULL;
+	while ((elem = nvlist_next_nvpair(props, elem)) != NULL) {
+		switch (zfs_name_to_prop(nvpair_name(elem))) {
+		case ZFS_PROP_MOUNTPOINT:
+		case ZFS_PROP_SHARENFS:
+		case ZFS_PROP_SHARESMB:
+		case ZFS_PROP_CANMOUNT:
+		case ZFS_PROP_ZONED:
+		case ZFS_PROP_VOLSIZE:
+		case ZFS_PROP_ATIME:
+		case ZFS_PROP_RELATIME:
+		case ZFS_PROP_DEVICES:
+		case ZFS_PROP_EXEC:
+		case ZFS_PROP_SETUID:
+		case ZFS_PROP_READONLY:
+		case ZFS_PROP_XATTR:
+		case ZFS_PROP_NBMAND:
+			return zfs_prop_set_list(zhp, props);
+		default:
+			break;
+		}
+	}
+
+	(void) snprintf(errbuf, sizeof (errbuf),
+		"cannot set property for '%s'", zfs_get_name(zhp));
+#if LIBZFS_VERSION_MINOR == 7
+	real_props = zfs_valid_proplist(libzfs_get_handle(), zfs_get_type(zhp),
+		props, zoned, zhp, zfs_get_pool_handle(zhp), errbuf);
+#else
+	real_props = zfs_valid_proplist(libzfs_get_handle(), zfs_get_type(zhp),
+		props, zoned, zhp, zfs_get_pool_handle(zhp), B_FALSE, errbuf);
+#endif
+	if (real_props == NULL) {
+		return -1;
+	}
+	packed = fnvlist_pack(real_props, &size);
+	nvlist_free(real_props);
+	dst = malloc(dstsize);
+
+	memset(&zc, 0, sizeof (zc));
+	(void) strncpy(zc.zc_name, zfs_get_name(zhp), sizeof (zc.zc_name) - 1);
+	zc.zc_nvlist_src = (uint64_t)(uintptr_t)packed;
+	zc.zc_nvlist_src_size = size;
+	zc.zc_nvlist_dst = (uint64_t)(uintptr_t)dst;
+	zc.zc_nvlist_dst_size = dstsize;
+	if (zfs_ioctl(libzfs_get_handle(), ZFS_IOC_SET_PROP, &zc) != 0) {
+		rc = errno;
+		if (zc.zc_nvlist_dst_filled &&
+			nvlist_unpack(dst, zc.zc_nvlist_dst_size, errlist, 0) != 0) {
+			*errlist = NULL;
+		}
+	}
+	fnvlist_pack_free(packed, size);
+	free(dst);
+	return rc;
+}
+
+typedef struct inherit_cbdata {
+	const char *prop;
+	boolean_t received;
+} inherit_cbdata_t;
+
+static int inherit_recurse_cb(zfs_handle_t *zhp, void *data) {
+	inherit_cbdata_t *cb = (inherit_cbdata_t *)data;
+	zfs_prop_t prop = zfs_name_to_prop(cb->prop);
+	int ret = 0;
+
+	/* skip datasets (e.g. snapshots) native property doesn't apply to */
+	if (prop == ZPROP_INVAL ||
+		zfs_prop_valid_for_type(prop, zfs_get_type(zhp), B_FALSE)) {
+		ret = zfs_prop_inherit(zhp, cb->prop, cb->received);
+	}
+	if (ret == 0) {
+		ret = zfs_iter_children(zhp, inherit_recurse_cb, cb);
+	}
+	zfs_close(zhp);
+	return ret;
+}
+
+int dataset_prop_inherit(dataset_list_ptr dataset, const char *prop, boolean_t recursive, boolean_t received) {
+	inherit_cbdata_t cb = {prop, received};
+	int ret = zfs_prop_inherit(dataset->zh, prop, received);
+	if (ret == 0 && recursive) {
+		ret = zfs_iter_children(dataset->zh, inherit_recurse_cb, &cb);
+	}
+	return ret;
+}
+
 int dataset_clone(dataset_list_ptr dataset, const char *target, nvlist_ptr props) {
 	return zfs_clone(dataset->zh, target, props);
 }
 
+int dataset_clone_ex(dataset_list_ptr dataset, const char *target, nvlist_ptr props,
+	boolean_t parents) {
+	zfs_type_t types = ZFS_TYPE_FILESYSTEM | ZFS_TYPE_VOLUME;
+	if (parents && zfs_name_valid(target, types)) {
+		if (zfs_dataset_exists(libzfs_get_handle(), target, types)) {
+			return (0);
+		}
+		if (zfs_create_ancestors(libzfs_get_handle(), target) != 0) {
+			return (-1);
+		}
+	}
+	return zfs_clone(dataset->zh, target, props);
+}
+
 int dataset_snapshot(const char *path, boolean_t recur, nvlist_ptr props) {
 	return zfs_snapshot(libzfs_get_handle(), path, recur, props);
 }
@@ -152,6 +409,24 @@ int dataset_rename(dataset_list_ptr dataset, const char* new_name, boolean_t rec
 	return zfs_rename(dataset->zh, new_name, recur, force_unm);
 }
 
+int dataset_rename_ex(dataset_list_ptr dataset, const char *new_name, boolean_t recur,
+	boolean_t force_unm, boolean_t nounmount, boolean_t parents) {
+	if (parents && zfs_name_valid(new_name, zfs_get_type(dataset->zh)) &&
+		zfs_create_ancestors(libzfs_get_handle(), new_name) != 0) {
+		return (-1);
+	}
+#if LIBZFS_VERSION_MAJOR >= 2
+	renameflags_t flags = { 0 };
+	flags.recursive = recur;
+	flags.forceunmount = force_unm;
+	flags.nounmount = nounmount;
+	return zfs_rename(dataset->zh, new_name, flags);
+#else
+	/* no unmount is not supported by older libzfs, checked by caller */
+	return zfs_rename(dataset->zh, new_name, recur, force_unm);
+#endif
+}
+
 const char *dataset_is_mounted(dataset_list_ptr dataset){
 	char *mp = NULL;
 	// zfs_is_mounted returns B_TRUE or B_FALSE
@@ -195,6 +470,13 @@ property_list_t *read_dataset_property(dataset_list_t *dataset, int prop) {
 		// strcpy(list->name, zpool_prop_to_name(prop));
 		zprop_source_tostr(list->source, source);
 		list->property = (int)prop;
+		list->source_type = (int)source;
+		// keep raw value of numeric and index properties
+		if (zfs_prop_get_type(prop) != PROP_TYPE_STRING &&
+			zfs_prop_get_numeric(dataset->zh, prop, &list->numeric,
+			&source, NULL, 0) == 0) {
+			list->numeric_valid = 1;
+		}
 	} else if (list != NULL) {
 		free_properties(list);
 		list = NULL;
@@ -266,9 +548,25 @@ property_list_t *read_user_property(dataset_list_t *dataset, const char* prop) {
 	}
 	(void) strncpy(list->value,
 				strval, sizeof (list->value));
+	list->source_type = (int)sourcetype;
 	return list;
 }
 
+int channel_program(const char *pool, const char *program, uint64_t instrlimit,
+	uint64_t memlimit, boolean_t nosync, nvlist_ptr argnvl, nvlist_ptr *outnvl) {
+#if LIBZFS_VERSION_MINOR == 7
+	/* channel programs were introduced in 0.8 */
+	*outnvl = NULL;
+	return (ENOTSUP);
+#else
+	if (nosync) {
+		return lzc_channel_program_nosync(pool, program, instrlimit, memlimit,
+			argnvl, outnvl);
+	}
+	return lzc_channel_program(pool, program, instrlimit, memlimit, argnvl, outnvl);
+#endif
+}
+
 char** alloc_cstrings(int size) {
 	return malloc(size*sizeof(char*));
 }
@@ -292,6 +590,21 @@ void sendflags_set_raw(sendflags_t * flags) {
 #endif
 }
 
+/*
+ * Set send flags missing in older libzfs versions, callers check the
+ * version before using them
+ */
+void sendflags_set_ex(sendflags_t *flags, boolean_t backup, boolean_t holds,
+	boolean_t saved) {
+#if LIBZFS_VERSION_MINOR != 7
+	flags->backup = backup;
+#endif
+#if LIBZFS_VERSION_MAJOR >= 2
+	flags->holds = holds;
+	flags->saved = saved;
+#endif
+}
+
 recvflags_t *alloc_recvflags() {
 	recvflags_t *r = malloc(sizeof(recvflags_t));
 	memset(r, 0, sizeof(recvflags_t));
@@ -311,6 +624,54 @@ int estimate_send_size(struct zfs_cmd *zc) {
 	}
 	return rc;
 }
+/*
+ * Estimate size of send stream of snapname, incremental if from (snapshot or
+ * bookmark) is not NULL
+ */
+int dataset_send_space(const char *snapname, const char *from, sendflags_t *flags,
+	uint64_t *space) {
+	enum lzc_send_flags lzc_flags = 0;
+
+	if (flags->largeblock) {
+		lzc_flags |= LZC_SEND_FLAG_LARGE_BLOCK;
+	}
+	if (flags->embed_data) {
+		lzc_flags |= LZC_SEND_FLAG_EMBED_DATA;
+	}
+	if (flags->compress) {
+		lzc_flags |= LZC_SEND_FLAG_COMPRESS;
+	}
+#if LIBZFS_VERSION_MINOR != 7
+	if (flags->raw) {
+		lzc_flags |= LZC_SEND_FLAG_RAW;
+	}
+#endif
+	return lzc_send_space(snapname, from, lzc_flags, space);
+}
+
+/*
+ * Query progress of send of snapname running in this process and writing to
+ * fd, returns errno (ENOENT if snapname is not being sent to fd)
+ */
+int dataset_send_progress(const char *snapname, int fd, uint64_t *bytes_written,
+	uint64_t *blocks_visited) {
+	struct zfs_cmd zc;
+
+	memset(&zc, 0, sizeof (zc));
+	(void) strncpy(zc.zc_name, snapname, sizeof (zc.zc_name) - 1);
+	zc.zc_cookie = fd;
+	if (zfs_ioctl(libzfs_get_handle(), ZFS_IOC_SEND_PROGRESS, &zc) != 0) {
+		return (errno);
+	}
+	*bytes_written = zc.zc_cookie;
+#if LIBZFS_VERSION_MAJOR >= 2
+	*blocks_visited = zc.zc_objset_type;
+#else
+	*blocks_visited = 0;
+#endif
+	return (0);
+}
+
 #if LIBZFS_VERSION_MINOR == 7
 int gozfs_send_one(zfs_handle_t *zhp, const char *from, int fd, sendflags_t *flags, const char *redactbook) {
     uint32_t lzc_send_flags = 0;
@@ -337,3 +698,42 @@ int gozfs_send_one(zfs_handle_t *zhp, const char *from, int fd, sendflags_t *fla
 #endif
 }
 #endif
+
+/*
+ * Create redaction bookmark bookname (short name) of snapshot, redacting
+ * blocks modified in redaction snapshots listed in snapnv as booleans.
+ * Redaction was introduced in 2.0.
+ */
+int dataset_redact(const char *snapshot, const char *bookname, nvlist_ptr snapnv) {
+#if LIBZFS_VERSION_MAJOR >= 2
+	return lzc_redact(snapshot, bookname, snapnv);
+#else
+	return (ENOTSUP);
+#endif
+}
+
+/*
+ * Send saved partial state of interrupted receive into zhp (zfs send -S),
+ * introduced in 2.0
+ */
+int dataset_send_saved(zfs_handle_t *zhp, sendflags_t *flags, int fd) {
+#if LIBZFS_VERSION_MAJOR >= 2
+	return zfs_send_saved(zhp, flags, fd, NULL);
+#else
+	return (ENOTSUP);
+#endif
+}
+
+/*
+ * Make raw received dataset its own encryption root, or inherit encryption
+ * root of its parent, without loaded keys. This is how libzfs fixes
+ * encryption hierarchy after replicated raw receive.
+ */
+int dataset_force_encryption_root(const char *fsname, boolean_t inherit) {
+#if LIBZFS_VERSION_MINOR == 7
+	return (ENOTSUP);
+#else
+	return lzc_change_key(fsname,
+		inherit ? DCP_CMD_FORCE_INHERIT : DCP_CMD_FORCE_NEW_KEY, NULL, NULL, 0);
+#endif
+}
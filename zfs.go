@@ -1,7 +1,7 @@
 package zfs
 
 import (
-	"os"
+	"io"
 )
 
 type Version struct {
@@ -29,12 +29,20 @@ type RollbackFlags struct {
 	IsRecursiveDestroy 		bool //-r
 	R						bool //-R
 	IsForcedToUnmountClones	bool //-f w/o -R
+	IsDryRun				bool // only list what would be destroyed
 }
 
 type CloneFlags struct {
 	IsParentCreated			bool //-p
 }
 
+type RenameFlags struct {
+	IsRecursive				bool //-r snapshots only
+	IsParentCreated			bool //-p not for snapshots
+	IsForcedToUnmount		bool //-f
+	NoUnmount				bool //-u libzfs 2.0 and newer
+}
+
 type ListFlags struct {
 	IsRecursive				bool 		`json:"recursive"`	//-p
 	Depth					int  		`json:"depth"`		//-d
@@ -66,6 +74,7 @@ type SendFlags struct {
 	Raw		   bool `json:"raw"`		//--raw
 	Backup     bool `json:"backup"`		//-b
 	Holds	   bool `json:"holds"`		//-h
+	Saved      bool `json:"saved"`		//-S, see SendSaved
 }
 
 type RecvFlags struct {
@@ -100,9 +109,9 @@ type IDataset interface {
 	Properties() (map[DatasetProp]PropertyValue, error)
 	Mount(*MountFlags) (error)
 	Umount(force, isAll bool) (error)
-	SendFrom(from string, outf *os.File, flags SendFlags) (error)
+	SendFrom(from string, outf io.Writer, flags SendFlags) (error)
 	SendSize(from string, flags *SendFlags) (int64, error)
 	ReceiveResumeToken() (string, error)
-	Receive(inf *os.File, flags *RecvFlags) (int64, error)
+	Receive(inf io.Reader, flags *RecvFlags) (int64, error)
 	ReceiveResumeAbort() (error)
 }
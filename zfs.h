@@ -114,15 +114,26 @@ zfs_type_t dataset_type(dataset_list_ptr dataset);
 
 dataset_list_ptr dataset_open(const char *path);
 int dataset_create(const char *path, zfs_type_t type, nvlist_ptr props);
+uint64_t volume_resize_reservation(zfs_handle_t *zhp, uint64_t volsize, uint64_t *cur);
+int dataset_create_ex(const char *path, zfs_type_t type, nvlist_ptr props,
+	boolean_t parents, boolean_t sparse);
 int dataset_destroy(dataset_list_ptr dataset, boolean_t defer);
 zpool_list_ptr dataset_get_pool(dataset_list_ptr dataset);
 int dataset_prop_set(dataset_list_ptr dataset, zfs_prop_t prop, const char *value);
 int dataset_user_prop_set(dataset_list_ptr dataset, const char *prop, const char *value);
+int dataset_prop_valid(dataset_list_ptr dataset, nvlist_ptr props);
+int dataset_prop_set_list(dataset_list_ptr dataset, nvlist_ptr props,
+	nvlist_ptr *errlist);
+int dataset_prop_inherit(dataset_list_ptr dataset, const char *prop, boolean_t recursive, boolean_t received);
 int dataset_clone(dataset_list_ptr dataset, const char *target, nvlist_ptr props);
+int dataset_clone_ex(dataset_list_ptr dataset, const char *target, nvlist_ptr props,
+	boolean_t parents);
 int dataset_snapshot(const char *path, boolean_t recur, nvlist_ptr props);
 int dataset_rollback(dataset_list_ptr dataset, dataset_list_ptr snapshot, boolean_t force);
 int dataset_promote(dataset_list_ptr dataset);
 int dataset_rename(dataset_list_ptr dataset, const char* new_name, boolean_t recur, boolean_t force_unm);
+int dataset_rename_ex(dataset_list_ptr dataset, const char *new_name, boolean_t recur,
+	boolean_t force_unm, boolean_t nounmount, boolean_t parents);
 const char* dataset_is_mounted(dataset_list_ptr dataset);
 int dataset_mount(dataset_list_ptr dataset, const char *options, int flags);
 int dataset_unmount(dataset_list_ptr dataset, int flags);
@@ -132,19 +143,43 @@ const char *dataset_get_name(dataset_list_ptr ds);
 property_list_t *read_dataset_property(dataset_list_t *dataset, int prop);
 property_list_t *read_user_property(dataset_list_t *dataset, const char* prop);
 
+/* reasons why dataset_destroy_gather refused to destroy */
+#define DESTROY_HAS_CHILDREN	1
+#define DESTROY_HAS_CLONES		2
+
+int dataset_destroy_gather(const char *target, boolean_t recurse, boolean_t doclones,
+	nvlist_ptr names, char *errname, int errlen);
+int dataset_destroy_list(nvlist_ptr names, boolean_t force, boolean_t defer);
+int dataset_rollback_gather(dataset_list_ptr dataset, dataset_list_ptr snapshot,
+	boolean_t doclones, nvlist_ptr names, char *errname, int errlen);
+int dataset_snapspec_gather(const char *fsname, const char *spec, nvlist_ptr names);
+int dataset_holds_gather(dataset_list_ptr dataset, boolean_t recursive, nvlist_ptr holds);
+
 char** alloc_cstrings(int size);
 void strings_setat(char **a, int at, char *v);
 
+int channel_program(const char *pool, const char *program, uint64_t instrlimit,
+	uint64_t memlimit, boolean_t nosync, nvlist_ptr argnvl, nvlist_ptr *outnvl);
+
 sendflags_t *alloc_sendflags();
 void sendflags_set_raw(sendflags_t *flags);
+void sendflags_set_ex(sendflags_t *flags, boolean_t backup, boolean_t holds,
+	boolean_t saved);
 recvflags_t *alloc_recvflags();
 
 
 struct zfs_cmd *new_zfs_cmd();
 int estimate_send_size(struct zfs_cmd *zc);
+int dataset_send_space(const char *snapname, const char *from, sendflags_t *flags,
+	uint64_t *space);
+int dataset_send_progress(const char *snapname, int fd, uint64_t *bytes_written,
+	uint64_t *blocks_visited);
 
 extern int gozfs_send_one(zfs_handle_t *, const char *, int, sendflags_t *,
     const char *);
+int dataset_redact(const char *snapshot, const char *bookname, nvlist_ptr snapnv);
+int dataset_send_saved(zfs_handle_t *zhp, sendflags_t *flags, int fd);
+int dataset_force_encryption_root(const char *fsname, boolean_t inherit);
 
 #endif
 /* SERVERWARE_ZFS_H */
@@ -10,6 +10,7 @@ package zfs
 import "C"
 import (
 	"fmt"
+	"syscall"
 	"unsafe"
 )
 
@@ -50,3 +51,77 @@ func AbortResumable(dtname string) error {
 	return nil
 }
 
+// ResumeTokenInfo - content of receive resume token
+type ResumeTokenInfo struct {
+	ToName   string `json:"toname"`   // snapshot being received
+	ToGUID   uint64 `json:"toguid"`   // guid of snapshot being received
+	FromGUID uint64 `json:"fromguid"` // guid of incremental source, 0 for full stream
+	Object   uint64 `json:"object"`   // object to resume from
+	Offset   uint64 `json:"offset"`   // offset in object to resume from
+	Bytes    uint64 `json:"bytes"`    // bytes received so far
+	// stream features send has to be resumed with
+	EmbedOK      bool `json:"embedok"`
+	CompressOK   bool `json:"compressok"`
+	LargeBlockOK bool `json:"largeblockok"`
+	RawOK        bool `json:"rawok"`
+}
+
+// SendFlags - flags of stream the token belongs to, resumed send has to use
+// them
+func (t *ResumeTokenInfo) SendFlags() SendFlags {
+	return SendFlags{
+		EmbedData:  t.EmbedOK,
+		Compress:   t.CompressOK,
+		LargeBlock: t.LargeBlockOK,
+		Raw:        t.RawOK,
+	}
+}
+
+// ResumeToken returns receive_resume_token of dataset left by interrupted
+// resumable receive, empty if there is no resumable state
+func (d *Dataset) ResumeToken() (token string, err error) {
+	var prop PropertyValue
+	if prop, err = d.GetProperty(DatasetPropReceiveResumeToken); err != nil {
+		return
+	}
+	if prop.Value != "-" {
+		token = prop.Value
+	}
+	return
+}
+
+// DecodeResumeToken decompress and parse receive resume token
+func DecodeResumeToken(token string) (info ResumeTokenInfo, err error) {
+	csToken := C.CString(token)
+	defer C.free(unsafe.Pointer(csToken))
+	nvl := C.zfs_send_resume_token_to_nvlist(C.libzfs_get_handle(), csToken)
+	if nvl == nil {
+		err = NewError(EBadstream, "invalid resume token")
+		return
+	}
+	m := fromNvlist(nvl)
+	C.nvlist_free(nvl)
+	info.ToName, _ = m["toname"].(string)
+	info.ToGUID, _ = m["toguid"].(uint64)
+	info.FromGUID, _ = m["fromguid"].(uint64)
+	info.Object, _ = m["object"].(uint64)
+	info.Offset, _ = m["offset"].(uint64)
+	info.Bytes, _ = m["bytes"].(uint64)
+	_, info.EmbedOK = m["embedok"]
+	_, info.CompressOK = m["compressok"]
+	_, info.LargeBlockOK = m["largeblockok"]
+	_, info.RawOK = m["rawok"]
+	return
+}
+
+// forceEncryptionRoot - make raw received dataset name its own encryption
+// root, or inherit encryption root of its parent. Keys don't have to be
+// loaded.
+func forceEncryptionRoot(name string, inherit bool) (err error) {
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	if rc := C.dataset_force_encryption_root(csName, booleanT(inherit)); rc != 0 {
+		err = errnoError(syscall.Errno(rc), fmt.Sprintf("cannot change encryption root of '%s'", name))
+	}
+	return
+}
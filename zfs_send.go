@@ -9,20 +9,73 @@ package zfs
 // #include <string.h>
 import "C"
 import (
-	"os"
+	"fmt"
+	"io"
 	"unsafe"
 )
 
-func SendResume(outf *os.File, flags *SendFlags, resumeToken string) error {
-	cflags := to_sendflags_t(flags)
+// SendResume - resume interrupted send using receive_resume_token of
+// partially received dataset, stream is written to outf.
+func SendResume(outf io.Writer, flags *SendFlags, resumeToken string) error {
+	return SendResumeWithOptions(outf, resumeToken, SendOptions{SendFlags: *flags})
+}
+
+// SendResumeWithOptions - same as SendResume with options e.g. progress
+// reporting. Total estimate is not known for resumed sends.
+func SendResumeWithOptions(outf io.Writer, resumeToken string, opts SendOptions) error {
+	if err := checkSendFlags(&opts.SendFlags); err != nil {
+		return err
+	}
+	cflags := to_sendflags_t(&opts.SendFlags)
 	defer C.free(unsafe.Pointer(cflags))
 
 	cresume_token := C.CString(resumeToken)
 	defer C.free(unsafe.Pointer(cresume_token))
 
-	rc := C.zfs_send_resume(C.libzfs_get_handle(), cflags, C.int(outf.Fd()), cresume_token)
-	if rc != 0 {
-		return LastError()
+	var names []string
+	if opts.OnProgress != nil {
+		if info, err := DecodeResumeToken(resumeToken); err == nil {
+			names = append(names, info.ToName)
+		}
+	}
+	return withWriteFd(outf, func(fd uintptr) error {
+		defer startSendProgress(&opts, fd, names, nil)()
+		if C.zfs_send_resume(C.libzfs_get_handle(), cflags, C.int(fd), cresume_token) != 0 {
+			return LastError()
+		}
+		return nil
+	})
+}
+
+// SendSaved - send saved partial state of interrupted resumable receive into
+// filesystem or volume d (zfs send -S) to outf. Receiving it elsewhere with
+// Resumable flag creates the same partial state, which can be resumed from
+// original source. Flags have to match resume token of d (see
+// ResumeTokenInfo.SendFlags). Progress is not reported. Requires OpenZFS 2.0
+// or newer.
+func (d *Dataset) SendSaved(outf io.Writer, opts SendOptions) (err error) {
+	var path string
+	if path, err = d.Path(); err != nil {
+		return
+	}
+	if d.Type != DatasetTypeFilesystem && d.Type != DatasetTypeVolume {
+		err = NewError(EBadtype, fmt.Sprintf("'%s' is not a filesystem or volume", path))
+		return
+	}
+	if opts.Replicate || opts.DoAll || opts.FromOrigin || opts.Props {
+		err = NewError(ENotsup, "Unsupported flag with saved send.")
+		return
 	}
-	return nil
+	opts.Saved = true
+	if err = checkSendFlags(&opts.SendFlags); err != nil {
+		return
+	}
+	cflags := to_sendflags_t(&opts.SendFlags)
+	defer C.free(unsafe.Pointer(cflags))
+	return withWriteFd(outf, func(fd uintptr) error {
+		if C.dataset_send_saved(d.list.zh, cflags, C.int(fd)) != 0 {
+			return LastError()
+		}
+		return nil
+	})
 }
@@ -1,9 +1,17 @@
 package zfs
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hainguyen8y/go-libzfs/sendstream"
 )
 //go test -v -run TestDatasetCreate -args --pool=data
 var hostAddress = flag.String("host", "127.0.0.1:10000", "the host running zfs service")
@@ -66,6 +74,148 @@ func TestDatasetCreate(t *testing.T) {
 	d.Close()
 }
 
+func TestDatasetCreateWithFlags(t *testing.T) {
+	path := TSTDatasetPath + "/PARENTS/A/B"
+	t.Log("TEST DatasetCreateWithFlags(", path, ") (parents) ... ")
+	props := make(map[DatasetProp]PropertyValue)
+	d, err := DatasetCreateWithFlags(path, DatasetTypeFilesystem, props,
+		&CreateFlags{IsParentCreated: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	d.Close()
+
+	props[DatasetPropVolsize] = PropertyValue{Value: "16777216"}
+	for _, sparse := range []bool{false, true} {
+		vpath := fmt.Sprintf("%s/VOL-sparse-%v", path, sparse)
+		t.Log("TEST DatasetCreateWithFlags(", vpath, ") (volume) ... ")
+		if d, err = DatasetCreateWithFlags(vpath, DatasetTypeVolume, props,
+			&CreateFlags{SparseVolume: sparse}); err != nil {
+			t.Error(err)
+			return
+		}
+		var resv uint64
+		resv, err = d.GetUint64(DatasetPropRefreservation)
+		d.Close()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if sparse != (resv == 0) {
+			t.Errorf("unexpected refreservation %d of volume %s", resv, vpath)
+			return
+		}
+	}
+
+	if d, err = DatasetOpen(TSTDatasetPath + "/PARENTS"); err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	if err = d.DestroyRecursive(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVolumeResize(t *testing.T) {
+	t.Log("TEST Resize(", TSTVolumePath, ") ... ")
+	d, err := DatasetOpen(TSTVolumePath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	dev, err := d.VolumeDevice()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if dev != "/dev/zvol/"+TSTVolumePath {
+		t.Errorf("unexpected volume device %s", dev)
+	}
+	// device links are created by udev, without it there is nothing to wait for
+	if _, serr := os.Stat("/run/udev/control"); serr != nil {
+		t.Log("udev is not running, WaitForDevice skipped")
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err = d.WaitForDevice(ctx); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	size, err := d.GetUint64(DatasetPropVolsize)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = d.Resize(size+1000, false); err == nil {
+		t.Error("size not aligned to volblocksize have to fail")
+	}
+	if err = d.Resize(size-4096, false); err == nil {
+		t.Error("shrinking without allowShrink have to fail")
+	}
+	if err = d.Resize(size+1<<20, false); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = d.Resize(size, true); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestVolumeResizeReservation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		sparse bool
+		props  map[DatasetProp]PropertyValue
+	}{
+		// default refreservation grows with volsize
+		{"THICK", false, map[DatasetProp]PropertyValue{}},
+		// manual refreservation of sparse volume is left alone
+		{"SPARSE", true, map[DatasetProp]PropertyValue{DatasetPropRefreservation: {Value: "1M"}}},
+	} {
+		path := TSTDatasetPath + "/" + tc.name
+		t.Log("TEST Resize(", path, ") beyond available space ... ")
+		tc.props[DatasetPropVolsize] = PropertyValue{Value: "67108864"} // 64M
+		d, err := DatasetCreateWithFlags(path, DatasetTypeVolume, tc.props, &CreateFlags{SparseVolume: tc.sparse})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer d.Close()
+		defer d.Destroy(false)
+		avail, err := d.GetUint64(DatasetPropAvailable)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		blocksize, err := d.GetUint64(DatasetPropVolblocksize)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		newSize := (2*avail/blocksize + 1) * blocksize
+		err = d.Resize(newSize, false)
+		if !tc.sparse {
+			if zerr, ok := err.(*Error); !ok || zerr.ErrorCode() != ENospc {
+				t.Errorf("%s: growing thick volume beyond available space have to fail, got %v", path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if refresv, err := d.GetUint64(DatasetPropRefreservation); err != nil || refresv != 1<<20 {
+			t.Errorf("%s: manual refreservation changed to %d (%v)", path, refresv, err)
+		}
+	}
+}
+
 func TestDatasetOpen(t *testing.T) {
 	t.Log("TEST DatasetOpen(", TSTDatasetPath, ") ... ")
 	d, err := DatasetOpen(TSTDatasetPath)
@@ -115,6 +265,85 @@ func TestDatasetSetProperty(t *testing.T) {
 	return
 }
 
+func TestDatasetSetProperties(t *testing.T) {
+	t.Log("TEST Dataset SetProperties(", TSTDatasetPath, ") ... ")
+	d, err := DatasetOpen(TSTDatasetPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	err = d.SetProperties(map[DatasetProp]string{
+		DatasetPropQuota:       "1G",
+		DatasetPropCompression: "not-a-compression",
+	}, nil)
+	if perr, ok := err.(*PropertiesError); !ok {
+		t.Error(fmt.Errorf("expected *PropertiesError, got %v", err))
+		return
+	} else if _, ok = perr.Errors["compression"]; !ok {
+		t.Error(fmt.Errorf("compression have to be rejected: %v", perr))
+		return
+	}
+	if d.Properties[DatasetPropQuota].Source == "local" {
+		t.Error(fmt.Errorf("quota have not to be set"))
+		return
+	}
+	err = d.SetProperties(map[DatasetProp]string{
+		DatasetPropQuota:       "1G",
+		DatasetPropCompression: "lz4",
+	}, map[string]string{"go-libzfs:test": "multi"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// quota below used space is refused by kernel, recordsize is still set
+	err = d.SetProperties(map[DatasetProp]string{
+		DatasetPropQuota:      "1M",
+		DatasetPropRecordsize: "64K",
+	}, nil)
+	if perr, ok := err.(*PropertiesError); !ok {
+		t.Error(fmt.Errorf("expected *PropertiesError, got %v", err))
+		return
+	} else if qerr, ok := perr.Errors["quota"].(*Error); !ok || qerr.ErrorCode() != ENospc || len(perr.Errors) != 1 {
+		t.Error(fmt.Errorf("only quota have to be rejected with ENospc: %v", perr))
+		return
+	}
+	if err = d.SetProperty(DatasetPropQuota, "none"); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestDatasetInheritProperty(t *testing.T) {
+	t.Log("TEST Dataset InheritProperty(", TSTDatasetPath, ") ... ")
+	d, err := DatasetOpen(TSTDatasetPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	if err = d.SetProperty(DatasetPropAtime, "off"); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = d.InheritProperty(DatasetPropAtime, true, false); err != nil {
+		t.Error(err)
+		return
+	}
+	if d.Properties[DatasetPropAtime].Source == "local" {
+		t.Error(fmt.Errorf("Inherit of dataset property failed"))
+		return
+	}
+	if err = d.InheritProperty(DatasetPropQuota, false, false); err == nil {
+		t.Error(fmt.Errorf("quota have to be non inheritable"))
+		return
+	}
+	if err = d.InheritUserProperty("go-libzfs:test", false, false); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
 func TestDatasetOpenAll(t *testing.T) {
 	t.Log("TEST DatasetOpenAll()/DatasetCloseAll() ... ")
 	ds, err := DatasetOpenAll()
@@ -141,6 +370,29 @@ func TestDatasetSnapshot(t *testing.T) {
 	defer d.Close()
 }
 
+func TestSnapshotMany(t *testing.T) {
+	t.Log("TEST SnapshotMany(", TSTDatasetPath, ", ", TSTVolumePath, ") ... ")
+	names := []string{TSTDatasetPath + "@many", TSTVolumePath + "@many"}
+	snaps, err := SnapshotMany(names, map[string]string{"go-libzfs:test": "many"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer DatasetCloseAll(snaps)
+	if len(snaps) != len(names) {
+		t.Error(fmt.Errorf("expected %d snapshots, got %d", len(names), len(snaps)))
+		return
+	}
+	// creating them again have to fail for each of snapshots
+	_, err = SnapshotMany(names, nil)
+	if berr, ok := err.(*BatchError); !ok || len(berr.Errors) != len(names) {
+		t.Error(fmt.Errorf("expected error per snapshot, got %v", err))
+	}
+	for _, s := range snaps {
+		s.Destroy(false)
+	}
+}
+
 func TestDatasetHoldRelease(t *testing.T) {
 	t.Log("TEST Hold/Release(", TSTDatasetPathSnap, ", true, ...) ... ")
 	d, err := DatasetOpen(TSTDatasetPathSnap)
@@ -181,6 +433,636 @@ func TestDatasetHoldRelease(t *testing.T) {
 	}
 }
 
+func TestDatasetHoldRecursive(t *testing.T) {
+	t.Log("TEST HoldRecursive/HoldsRecursive(", TSTDatasetPathSnap, ") ... ")
+	d, err := DatasetOpen(TSTDatasetPathSnap)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	fs, err := DatasetOpen(TSTDatasetPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer fs.Close()
+	if err = d.HoldRecursive("keep-r"); err != nil {
+		t.Error(err)
+		return
+	}
+	holds, err := fs.HoldsRecursive()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	volSnap := TSTVolumePath + "@test"
+	if len(holds[TSTDatasetPathSnap]) != 1 || len(holds[volSnap]) != 1 {
+		t.Error(fmt.Errorf("expected hold on %s and %s, got %v", TSTDatasetPathSnap, volSnap, holds))
+		return
+	}
+	if err = d.ReleaseRecursive("keep-r"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Log("TEST HoldSnapshots(", TSTDatasetPathSnap, ", ", volSnap, ") (temporary) ... ")
+	cleanup, err := OpenHoldCleanup()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = HoldSnapshots(map[string]string{TSTDatasetPathSnap: "temp", volSnap: "temp"}, cleanup)
+	if err != nil {
+		cleanup.Close()
+		t.Error(err)
+		return
+	}
+	if holds, err = fs.HoldsRecursive(); err != nil || len(holds) != 2 {
+		cleanup.Close()
+		t.Error(fmt.Errorf("expected 2 held snapshots, got %v (%v)", holds, err))
+		return
+	}
+	cleanup.Close()
+	if holds, err = fs.HoldsRecursive(); err != nil || len(holds) != 0 {
+		t.Error(fmt.Errorf("expected temporary holds released, got %v (%v)", holds, err))
+		return
+	}
+
+	err = HoldSnapshots(map[string]string{TSTDatasetPathSnap: "batch"}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = ReleaseSnapshots(map[string][]string{TSTDatasetPathSnap: {"batch"}}); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestRenameSnapshot(t *testing.T) {
+	t.Log("TEST RenameSnapshot(", TSTDatasetPathSnap, ", @renamed, true) ... ")
+	if err := RenameSnapshot(TSTDatasetPathSnap, TSTVolumePath+"@renamed", false); err == nil {
+		t.Error("rename to another filesystem have to fail")
+		return
+	}
+	if err := RenameSnapshot(TSTDatasetPathSnap, "@renamed", true); err != nil {
+		t.Error(err)
+		return
+	}
+	d, err := DatasetOpen(TSTVolumePath + "@renamed")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	d.Close()
+	if err = RenameSnapshot(TSTDatasetPath+"@renamed", TSTDatasetPathSnap, true); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestDatasetRollbackWithFlags(t *testing.T) {
+	t.Log("TEST RollbackWithFlags(", TSTDatasetPathSnap, ") ... ")
+	d, err := DatasetOpenSingle(TSTDatasetPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	snap, err := DatasetOpenSingle(TSTDatasetPathSnap)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer snap.Close()
+	later, err := DatasetSnapshot(TSTDatasetPath+"@later", false, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	later.Close()
+
+	if _, err = d.RollbackWithFlags(&snap, &RollbackFlags{}); err == nil {
+		t.Error(fmt.Errorf("rollback have to fail without recursive destroy"))
+		return
+	}
+	destroyed, err := d.RollbackWithFlags(&snap, &RollbackFlags{IsRecursiveDestroy: true, IsDryRun: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(destroyed) != 1 || destroyed[0] != TSTDatasetPath+"@later" {
+		t.Error(fmt.Errorf("wrong list of datasets to destroy %v", destroyed))
+		return
+	}
+	if _, err = d.RollbackWithFlags(&snap, &RollbackFlags{IsRecursiveDestroy: true}); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestRunChannelProgram(t *testing.T) {
+	t.Log("TEST RunChannelProgram(", *testPool, ") ... ")
+	script := []byte(`args = ...
+return {name = args["name"], count = args["count"] + 1}`)
+	res, err := RunChannelProgram(*testPool, script,
+		map[string]interface{}{"name": TSTDatasetPath, "count": int64(1)},
+		ProgramOptions{NoSync: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ret, ok := res["return"].(map[string]interface{})
+	if !ok || ret["name"] != TSTDatasetPath || ret["count"] != int64(2) {
+		t.Error(fmt.Errorf("unexpected program result %v", res))
+		return
+	}
+	if _, err = RunChannelProgram(*testPool, []byte("error('failed')"), nil,
+		ProgramOptions{NoSync: true}); err == nil {
+		t.Error("failing program have to return error")
+	}
+}
+
+func TestDatasetSendReceive(t *testing.T) {
+	t.Log("TEST Send(", TSTDatasetPathSnap, ") to buffer and Receive ... ")
+	snap, err := DatasetOpen(TSTDatasetPathSnap)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer snap.Close()
+	var stream bytes.Buffer
+	if err = snap.Send(&stream, SendFlags{}); err != nil {
+		t.Error(err)
+		return
+	}
+	d, err := DatasetOpen(TSTDatasetPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	// -e receives into TSTDatasetPath/<last element of sent name>
+	if err = d.Receive(&stream, RecvFlags{IsTail: true, NoMount: true}); err != nil {
+		t.Error(err)
+		return
+	}
+	recvPath := TSTDatasetPath + TSTDatasetPath[strings.LastIndex(TSTDatasetPath, "/"):]
+	recv, err := DatasetOpen(recvPath + "@test")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	recv.Close()
+	if recv, err = DatasetOpen(recvPath); err != nil {
+		t.Error(err)
+		return
+	}
+	defer recv.Close()
+	if err = recv.DestroyRecursive(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDatasetReceiveWithOptions(t *testing.T) {
+	t.Log("TEST ReceiveWithOptions(", TSTDatasetPath, ") with property overrides ... ")
+	snap, err := DatasetOpen(TSTDatasetPathSnap)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer snap.Close()
+	var stream bytes.Buffer
+	if err = snap.Send(&stream, SendFlags{Props: true}); err != nil {
+		t.Error(err)
+		return
+	}
+	d, err := DatasetOpen(TSTDatasetPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	opts := RecvOptions{
+		RecvFlags:    RecvFlags{IsTail: true, NoMount: true},
+		SetProps:     map[string]string{"compression": "off", "go-libzfs:recv": "yes"},
+		ExcludeProps: []string{"atime"},
+	}
+	bad := opts
+	bad.SetProps = map[string]string{"compression": "nonsense"}
+	if _, err = d.ReceiveWithOptions(bytes.NewReader(stream.Bytes()), bad); err == nil {
+		t.Error("invalid property value have to be rejected")
+		return
+	}
+	size := stream.Len()
+	res, err := d.ReceiveWithOptions(&stream, opts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	recvPath := TSTDatasetPath + TSTDatasetPath[strings.LastIndex(TSTDatasetPath, "/"):]
+	if res.Dataset != recvPath || len(res.Snapshots) != 1 || res.Snapshots[0] != recvPath+"@test" ||
+		res.BytesRead != uint64(size) || res.FromGUID != 0 || res.Resumable {
+		t.Errorf("unexpected receive result %+v", res)
+	}
+	recv, err := DatasetOpen(recvPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer recv.Close()
+	if prop, _ := recv.GetProperty(DatasetPropCompression); prop.Value != "off" {
+		t.Errorf("compression not overridden: %v", prop)
+	}
+	if prop, _ := recv.GetUserProperty("go-libzfs:recv"); prop.Value != "yes" {
+		t.Errorf("user property not set: %v", prop)
+	}
+	if err = recv.DestroyRecursive(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDatasetResumeToken(t *testing.T) {
+	t.Log("TEST ResumeToken/DecodeResumeToken(", TSTDatasetPath, ") interrupted receive ... ")
+	snap, err := DatasetOpen(TSTDatasetPathSnap)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer snap.Close()
+	var stream bytes.Buffer
+	if err = snap.Send(&stream, SendFlags{}); err != nil {
+		t.Error(err)
+		return
+	}
+	d, err := DatasetOpen(TSTDatasetPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	flags := RecvFlags{IsTail: true, NoMount: true, Resumable: true}
+	truncated := bytes.NewReader(stream.Bytes()[:stream.Len()/2])
+	res, err := d.ReceiveWithOptions(truncated, RecvOptions{RecvFlags: flags})
+	if err == nil || !res.Resumable {
+		t.Errorf("truncated receive have to fail with resumable state, got %v %+v", err, res)
+		return
+	}
+	recv, err := DatasetOpenSingle(res.Dataset)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer recv.Close()
+	token, err := recv.ResumeToken()
+	if err != nil || token != res.ResumeToken {
+		t.Errorf("unexpected resume token %q (%v)", token, err)
+		return
+	}
+	info, err := DecodeResumeToken(token)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info.ToName != TSTDatasetPathSnap || info.FromGUID != 0 {
+		t.Errorf("unexpected resume token content %+v", info)
+		return
+	}
+	var rest bytes.Buffer
+	sflags := info.SendFlags()
+	if err = SendResume(&rest, &sflags, token); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = d.ReceiveWithOptions(&rest, RecvOptions{RecvFlags: flags}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = recv.DestroyRecursive(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDatasetSendSaved(t *testing.T) {
+	t.Log("TEST SendSaved(", TSTDatasetPath, ") of interrupted receive ... ")
+	snap, err := DatasetOpen(TSTDatasetPathSnap)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer snap.Close()
+	var stream bytes.Buffer
+	if err = snap.Send(&stream, SendFlags{}); err != nil {
+		t.Error(err)
+		return
+	}
+	d, err := DatasetOpen(TSTDatasetPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	flags := RecvFlags{IsTail: true, NoMount: true, Resumable: true}
+	truncated := bytes.NewReader(stream.Bytes()[:stream.Len()/2])
+	res, err := d.ReceiveWithOptions(truncated, RecvOptions{RecvFlags: flags})
+	if err == nil || !res.Resumable {
+		t.Errorf("truncated receive have to fail with resumable state, got %v %+v", err, res)
+		return
+	}
+	defer AbortResumable(res.Dataset)
+	recv, err := DatasetOpenSingle(res.Dataset)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer recv.Close()
+	var saved bytes.Buffer
+	if err = recv.SendSaved(&saved, SendOptions{}); err != nil {
+		if e, ok := err.(*Error); ok && e.ErrorCode() == ENotsup {
+			t.Skip("saved send is not supported:", err)
+		}
+		t.Error(err)
+		return
+	}
+	sum, err := sendstream.Inspect(&saved)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(sum.Streams) != 1 || sum.Streams[0].ToGUID == 0 {
+		t.Errorf("unexpected saved stream %+v", sum.Streams)
+	}
+	if err = snap.Send(&saved, SendFlags{Saved: true}); err == nil {
+		t.Error("saved flag have to be rejected by Send")
+	}
+}
+
+func TestDatasetSendProgress(t *testing.T) {
+	t.Log("TEST SendWithOptions(", TSTDatasetPathSnap, ") with progress ... ")
+	snap, err := DatasetOpen(TSTDatasetPathSnap)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer snap.Close()
+	var stream bytes.Buffer
+	var last SendProgress
+	opts := SendOptions{
+		ProgressInterval: time.Millisecond,
+		OnProgress: func(p SendProgress) {
+			if p.BytesWritten < last.BytesWritten {
+				t.Errorf("progress went back from %d to %d", last.BytesWritten, p.BytesWritten)
+			}
+			last = p
+		},
+	}
+	if err = snap.SendWithOptions(&stream, "", opts); err != nil {
+		t.Error(err)
+		return
+	}
+	t.Log("last progress", last, "stream size", stream.Len())
+}
+
+func TestDatasetSendEstimate(t *testing.T) {
+	t.Log("TEST SendEstimate(", TSTDatasetPathSnap, ") replicated ... ")
+	snap, err := DatasetOpen(TSTDatasetPathSnap)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer snap.Close()
+	est, err := snap.SendEstimate("", SendFlags{Replicate: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	found := 0
+	for _, s := range est.Streams {
+		if s.To == TSTDatasetPathSnap || s.To == TSTVolumePath+"@test" {
+			found++
+		}
+	}
+	if found != 2 || est.Total == 0 {
+		t.Error(fmt.Errorf("unexpected estimate %+v", est))
+		return
+	}
+	size, err := snap.SendSize("", SendFlags{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if size <= 0 || uint64(size) > est.Total {
+		t.Error(fmt.Errorf("unexpected size %d of replicated estimate %d", size, est.Total))
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	target := TSTDatasetPath + "/REPLICA"
+	t.Log("TEST Replicate(", TSTDatasetPath, ",", target, ") ... ")
+	res, err := Replicate(TSTDatasetPath, target, ReplicateOptions{NoMount: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Base) > 0 || len(res.Received) == 0 || res.BytesSent == 0 {
+		t.Error(fmt.Errorf("unexpected result of full replication %+v", res))
+		return
+	}
+	snap, err := DatasetSnapshot(TSTDatasetPath+"@repl", false, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	snap.Close()
+	if res, err = Replicate(TSTDatasetPath, target, ReplicateOptions{NoMount: true}); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Base) == 0 || len(res.Received) != 1 || res.Received[0] != target+"@repl" {
+		t.Error(fmt.Errorf("unexpected result of incremental replication %+v", res))
+		return
+	}
+	if snap, err = DatasetSnapshot(target+"@extra", false, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	snap.Close()
+	if res, err = Replicate(TSTDatasetPath, target, ReplicateOptions{Prune: true}); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Received) != 0 || len(res.Pruned) != 1 || res.Pruned[0] != target+"@extra" {
+		t.Error(fmt.Errorf("unexpected result of pruning replication %+v", res))
+	}
+}
+
+func TestReplicatePruneBookmarkBase(t *testing.T) {
+	source := TSTDatasetPath + "/BMSOURCE"
+	target := TSTDatasetPath + "/BMREPLICA"
+	t.Log("TEST Replicate(", source, ",", target, ") from bookmark with prune ... ")
+	d, err := DatasetCreate(source, DatasetTypeFilesystem, make(map[DatasetProp]PropertyValue))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	d.Close()
+	a, err := DatasetSnapshot(source+"@a", false, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer a.Close()
+	if _, err = Replicate(source, target, ReplicateOptions{NoMount: true}); err != nil {
+		t.Error(err)
+		return
+	}
+	bm, err := a.CreateBookmark("a")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	bm.Close()
+	if err = a.Destroy(false); err != nil {
+		t.Error(err)
+		return
+	}
+	b, err := DatasetSnapshot(source+"@b", false, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b.Close()
+	// target@a is held as base during transfer and pruned after it
+	res, err := Replicate(source, target, ReplicateOptions{NoMount: true, Prune: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if res.Base != source+"#a" || len(res.Received) != 1 || res.Received[0] != target+"@b" ||
+		len(res.Pruned) != 1 || res.Pruned[0] != target+"@a" {
+		t.Error(fmt.Errorf("unexpected result of replication from bookmark %+v", res))
+	}
+}
+
+func TestReplicateRaw(t *testing.T) {
+	source := TSTDatasetPath + "/ENCRYPTED"
+	child := source + "/CHILD"
+	target := TSTDatasetPath + "/RAWREPLICA"
+	t.Log("TEST Replicate(", child, ",", target+"/CHILD", ") raw ... ")
+	keyFile, err := ioutil.TempFile("", "go-libzfs-key")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.Write(bytes.Repeat([]byte{0x5a}, 32))
+	keyFile.Close()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	d, err := DatasetCreate(source, DatasetTypeFilesystem, map[DatasetProp]PropertyValue{
+		DatasetPropEncryption:  {Value: "on"},
+		DatasetPropKeyFormat:   {Value: "raw"},
+		DatasetPropKeyLocation: {Value: "file://" + keyFile.Name()},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	d.Close()
+	if d, err = DatasetCreate(child, DatasetTypeFilesystem, make(map[DatasetProp]PropertyValue)); err != nil {
+		t.Error(err)
+		return
+	}
+	d.Close()
+	snap, err := DatasetSnapshot(source+"@a", true, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	snap.Close()
+	raw := ReplicateOptions{SendFlags: SendFlags{Raw: true}, NoMount: true}
+	if _, err = Replicate(source, target, raw); err != nil {
+		t.Error(err)
+		return
+	}
+	if root := encryptionRoot(target); root != target {
+		t.Errorf("encryption root of %s is %q", target, root)
+		return
+	}
+
+	// leave partial raw receive of child to be resumed by Replicate
+	if snap, err = DatasetOpen(child + "@a"); err != nil {
+		t.Error(err)
+		return
+	}
+	var stream bytes.Buffer
+	err = snap.SendWithOptions(&stream, "", SendOptions{SendFlags: SendFlags{Raw: true}})
+	snap.Close()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d, err = DatasetOpen(target); err != nil {
+		t.Error(err)
+		return
+	}
+	defer d.Close()
+	flags := RecvFlags{IsTail: true, NoMount: true, Resumable: true}
+	truncated := bytes.NewReader(stream.Bytes()[:stream.Len()/2])
+	if res, err := d.ReceiveWithOptions(truncated, RecvOptions{RecvFlags: flags}); err == nil || !res.Resumable {
+		t.Errorf("truncated receive have to fail with resumable state, got %v %+v", err, res)
+		return
+	}
+
+	opts := raw
+	opts.Resumable = true
+	opts.SetProps = map[string]string{"go-libzfs:replica": "yes"}
+	opts.ExcludeProps = []string{"atime"}
+	res, err := Replicate(child, target+"/CHILD", opts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if res.Resumed != child+"@a" {
+		t.Errorf("partial receive not resumed %+v", res)
+		return
+	}
+	// child inherits encryption root of replicated parent again
+	if root := encryptionRoot(target + "/CHILD"); root != target {
+		t.Errorf("encryption root of %s/CHILD is %q after full replication", target, root)
+		return
+	}
+	if snap, err = DatasetSnapshot(child+"@b", false, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	snap.Close()
+	if res, err = Replicate(child, target+"/CHILD", opts); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Received) != 1 || res.Received[0] != target+"/CHILD@b" {
+		t.Errorf("unexpected result of incremental raw replication %+v", res)
+		return
+	}
+	if root := encryptionRoot(target + "/CHILD"); root != target {
+		t.Errorf("encryption root of %s/CHILD is %q after incremental replication", target, root)
+		return
+	}
+	replica, err := DatasetOpen(target + "/CHILD")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer replica.Close()
+	if prop, err := replica.GetUserProperty("go-libzfs:replica"); err != nil || prop.Value != "yes" {
+		t.Errorf("SetProps not applied to replica: %+v %v", prop, err)
+	}
+}
+
 func TestDatasetDestroy(t *testing.T) {
 	t.Log("TEST DATASET Destroy( ", TSTDatasetPath, " ) ... ")
 	d, err := DatasetOpen(TSTDatasetPath)
@@ -0,0 +1,119 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "common.h"
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ZvolDevDir - directory of zvol device links created by udev
+const ZvolDevDir = "/dev/zvol"
+
+// zvolPollInterval - how often WaitForDevice checks for device node
+var zvolPollInterval = 100 * time.Millisecond
+
+// VolumeDevice returns path of volume block device /dev/zvol/<name>
+func (d *Dataset) VolumeDevice() (dev string, err error) {
+	var path string
+	if path, err = d.Path(); err != nil {
+		return
+	}
+	if d.Type != DatasetTypeVolume {
+		err = NewError(EBadtype, fmt.Sprintf("'%s' is not a volume", path))
+		return
+	}
+	dev = filepath.Join(ZvolDevDir, path)
+	return
+}
+
+// WaitForDevice waits until volume block device appears after volume was
+// created, cloned or renamed, or ctx is done. Devices of volumes with
+// volmode=none are never created and error is returned immediately.
+func (d *Dataset) WaitForDevice(ctx context.Context) (dev string, err error) {
+	if dev, err = d.VolumeDevice(); err != nil {
+		return
+	}
+	var volmode PropertyValue
+	if volmode, err = d.GetProperty(DatasetPropVolmode); err != nil {
+		return
+	}
+	if volmode.Value == "none" {
+		err = NewError(ENotsup, fmt.Sprintf("'%s' has volmode=none, device is not created", dev))
+		return
+	}
+	ticker := time.NewTicker(zvolPollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err = os.Stat(dev); err == nil || !os.IsNotExist(err) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Resize changes volsize of volume to newSize bytes. Size has to be multiple
+// of volblocksize and shrinking, which destroys data beyond new size, has to
+// be allowed explicitly. Growth of volume with default refreservation has to
+// be covered by available space since libzfs adjusts it with volsize.
+func (d *Dataset) Resize(newSize uint64, allowShrink bool) (err error) {
+	var path string
+	if path, err = d.Path(); err != nil {
+		return
+	}
+	if d.Type != DatasetTypeVolume {
+		err = NewError(EBadtype, fmt.Sprintf("'%s' is not a volume", path))
+		return
+	}
+	var volsize, blocksize, avail uint64
+	if volsize, err = d.GetUint64(DatasetPropVolsize); err != nil {
+		return
+	}
+	if blocksize, err = d.GetUint64(DatasetPropVolblocksize); err != nil {
+		return
+	}
+	switch {
+	case newSize == 0:
+		err = NewError(EBadprop, fmt.Sprintf("'%s': volsize cannot be zero", path))
+	case blocksize != 0 && newSize%blocksize != 0:
+		err = NewError(EBadprop, fmt.Sprintf("'%s': volsize %d must be a multiple of volblocksize %d",
+			path, newSize, blocksize))
+	case newSize < volsize && !allowShrink:
+		err = NewError(EBadprop, fmt.Sprintf("'%s': shrinking volume from %d to %d is not allowed",
+			path, volsize, newSize))
+	}
+	if err != nil || newSize == volsize {
+		return
+	}
+	if newSize > volsize {
+		// libzfs grows refreservation only if it is the default one for
+		// current volsize, kernel has final word on space it needs
+		var cur C.uint64_t
+		resv := uint64(C.volume_resize_reservation(d.list.zh, C.uint64_t(newSize), &cur))
+		if resv > uint64(cur) {
+			if avail, err = d.GetUint64(DatasetPropAvailable); err != nil {
+				return
+			}
+			if need := resv - uint64(cur); need > avail {
+				err = NewError(ENospc, fmt.Sprintf("'%s': growing volume reservation by %d requires more space than available %d",
+					path, need, avail))
+				return
+			}
+		}
+	}
+	return d.SetProperty(DatasetPropVolsize, strconv.FormatUint(newSize, 10))
+}